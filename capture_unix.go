@@ -0,0 +1,203 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+//go:build unix
+
+package testing
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	gc "gopkg.in/check.v1"
+
+	jc "github.com/juju/testing/checkers"
+)
+
+// OutputStream identifies a standard output stream.
+type OutputStream int
+
+const (
+	StdoutStream OutputStream = 1
+	StderrStream OutputStream = 2
+)
+
+// String returns the name of the stream.
+func (s OutputStream) String() string {
+	switch s {
+	case StdoutStream:
+		return "stdout"
+	case StderrStream:
+		return "stderr"
+	}
+	return "unknown stream"
+}
+
+// OutputChunk holds a chunk of output written to one of the
+// standard output streams.
+type OutputChunk struct {
+	Stream OutputStream
+	Data   []byte
+}
+
+// CapturedOutput holds the output captured by CaptureOutputFD.
+type CapturedOutput struct {
+	// Chunks holds all the output, in the order it was read.
+	// Output written to the same stream is always in the order
+	// it was written, but output written to different streams
+	// at nearly the same time may be read in either order.
+	Chunks []OutputChunk
+}
+
+// Stdout returns all the output written to standard output.
+func (o *CapturedOutput) Stdout() []byte {
+	return o.stream(StdoutStream)
+}
+
+// Stderr returns all the output written to standard error.
+func (o *CapturedOutput) Stderr() []byte {
+	return o.stream(StderrStream)
+}
+
+func (o *CapturedOutput) stream(stream OutputStream) []byte {
+	var buf bytes.Buffer
+	for _, chunk := range o.Chunks {
+		if chunk.Stream == stream {
+			buf.Write(chunk.Data)
+		}
+	}
+	return buf.Bytes()
+}
+
+// captureFDMutex prevents concurrent calls to CaptureOutputFD,
+// which would otherwise restore each other's file descriptors.
+var captureFDMutex sync.Mutex
+
+// CaptureOutputFD runs the given function and captures anything written
+// to file descriptors 1 and 2 during its execution. Unlike CaptureOutput,
+// which replaces os.Stdout and os.Stderr, it redirects the file
+// descriptors themselves, so it also captures output written by cgo
+// code, by child processes that inherit the descriptors, and through
+// references to os.Stdout and os.Stderr taken before it was called.
+//
+// If stdin is not nil, file descriptor 0 is redirected to read from it
+// for the duration of the call.
+//
+// The redirection applies to the whole process, so output written by
+// other goroutines while f runs is captured too. Any child processes
+// started by f must have exited, and any output buffered by C code must
+// have been flushed, by the time f returns.
+func CaptureOutputFD(c *gc.C, stdin io.Reader, f func()) *CapturedOutput {
+	captureFDMutex.Lock()
+	defer captureFDMutex.Unlock()
+
+	var (
+		mu     sync.Mutex
+		output CapturedOutput
+		wg     sync.WaitGroup
+	)
+	var restores []func() error
+	restore := func() {
+		for i := len(restores) - 1; i >= 0; i-- {
+			err := restores[i]()
+			c.Check(err, jc.ErrorIsNil)
+		}
+		restores = nil
+	}
+	defer restore()
+
+	for _, stream := range []OutputStream{StdoutStream, StderrStream} {
+		stream := stream
+		r, w, err := os.Pipe()
+		c.Assert(err, jc.ErrorIsNil)
+		undo, err := redirectFD(int(stream), w)
+		w.Close()
+		if err != nil {
+			r.Close()
+			c.Fatalf("cannot redirect %v: %v", stream, err)
+		}
+		restores = append(restores, undo)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer r.Close()
+			buf := make([]byte, 4096)
+			for {
+				n, err := r.Read(buf)
+				if n > 0 {
+					mu.Lock()
+					output.Chunks = append(output.Chunks, OutputChunk{
+						Stream: stream,
+						Data:   append([]byte(nil), buf[:n]...),
+					})
+					mu.Unlock()
+				}
+				if err != nil {
+					return
+				}
+			}
+		}()
+	}
+
+	if stdin != nil {
+		r, w, err := os.Pipe()
+		c.Assert(err, jc.ErrorIsNil)
+		undo, err := redirectFD(0, r)
+		if err != nil {
+			r.Close()
+			w.Close()
+			c.Fatalf("cannot redirect stdin: %v", err)
+		}
+		restores = append(restores, func() error {
+			err := undo()
+			// Closing the read end makes any write still
+			// in progress fail, so the copy below finishes
+			// even if f did not read all of stdin.
+			r.Close()
+			return err
+		})
+		go func() {
+			io.Copy(w, stdin)
+			w.Close()
+		}()
+	}
+
+	f()
+	restore()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(LongWait):
+		c.Fatalf("output still open after %v; is a child process still running?", LongWait)
+	}
+	return &output
+}
+
+// redirectFD makes the file descriptor fd refer to the same file as f,
+// and returns a function that makes it refer to its original file again.
+func redirectFD(fd int, f *os.File) (func() error, error) {
+	saved, err := syscall.Dup(fd)
+	if err != nil {
+		return nil, err
+	}
+	// Calling Fd puts the file into blocking mode, which the
+	// os.File values for the standard descriptors expect.
+	if err := dup2(int(f.Fd()), fd); err != nil {
+		syscall.Close(saved)
+		return nil, err
+	}
+	return func() error {
+		err := dup2(saved, fd)
+		syscall.Close(saved)
+		return err
+	}, nil
+}
@@ -0,0 +1,94 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+//go:build unix
+
+package testing_test
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+)
+
+type captureFDSuite struct{}
+
+var _ = gc.Suite(&captureFDSuite{})
+
+func (*captureFDSuite) TestCaptureOutputFD(c *gc.C) {
+	stdout := os.Stdout
+	output := testing.CaptureOutputFD(c, nil, func() {
+		// Write through a reference taken beforehand,
+		// and directly to the file descriptors.
+		fmt.Fprint(stdout, "via os.Stdout\n")
+		_, err := syscall.Write(2, []byte("via fd 2\n"))
+		c.Check(err, jc.ErrorIsNil)
+	})
+	c.Check(string(output.Stdout()), gc.Equals, "via os.Stdout\n")
+	c.Check(string(output.Stderr()), gc.Equals, "via fd 2\n")
+}
+
+func (*captureFDSuite) TestCaptureOutputFDChildProcess(c *gc.C) {
+	output := testing.CaptureOutputFD(c, nil, func() {
+		cmd := exec.Command("sh", "-c", "echo out; echo err >&2")
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		err := cmd.Run()
+		c.Check(err, jc.ErrorIsNil)
+	})
+	c.Check(string(output.Stdout()), gc.Equals, "out\n")
+	c.Check(string(output.Stderr()), gc.Equals, "err\n")
+}
+
+func (*captureFDSuite) TestCaptureOutputFDStdin(c *gc.C) {
+	var lines []string
+	output := testing.CaptureOutputFD(c, strings.NewReader("one\ntwo\n"), func() {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+			fmt.Println("read", scanner.Text())
+		}
+		c.Check(scanner.Err(), jc.ErrorIsNil)
+	})
+	c.Check(lines, jc.DeepEquals, []string{"one", "two"})
+	c.Check(string(output.Stdout()), gc.Equals, "read one\nread two\n")
+}
+
+func (*captureFDSuite) TestCaptureOutputFDStdinUnread(c *gc.C) {
+	input := strings.NewReader(strings.Repeat("x", 1<<20))
+	output := testing.CaptureOutputFD(c, input, func() {})
+	c.Check(output.Chunks, gc.HasLen, 0)
+}
+
+func (*captureFDSuite) TestCaptureOutputFDInterleaved(c *gc.C) {
+	output := testing.CaptureOutputFD(c, nil, func() {
+		cmd := exec.Command("sh", "-c", "echo 1; sleep 0.05; echo 2 >&2; sleep 0.05; echo 3")
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		err := cmd.Run()
+		c.Check(err, jc.ErrorIsNil)
+	})
+	c.Check(output.Chunks, jc.DeepEquals, []testing.OutputChunk{
+		{Stream: testing.StdoutStream, Data: []byte("1\n")},
+		{Stream: testing.StderrStream, Data: []byte("2\n")},
+		{Stream: testing.StdoutStream, Data: []byte("3\n")},
+	})
+}
+
+func (*captureFDSuite) TestCaptureOutputFDRestores(c *gc.C) {
+	testing.CaptureOutputFD(c, strings.NewReader(""), func() {})
+	var stat0, stat1 syscall.Stat_t
+	c.Assert(syscall.Fstat(1, &stat0), jc.ErrorIsNil)
+	c.Assert(syscall.Fstat(int(os.Stdout.Fd()), &stat1), jc.ErrorIsNil)
+	c.Check(stat0, jc.DeepEquals, stat1)
+	_, err := fmt.Fprint(os.Stdout, "")
+	c.Check(err, jc.ErrorIsNil)
+}
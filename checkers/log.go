@@ -5,6 +5,8 @@ package checkers
 
 import (
 	"fmt"
+	"log/slog"
+	"path/filepath"
 	"regexp"
 	"strings"
 
@@ -45,16 +47,26 @@ type logMatches struct {
 }
 
 func (checker *logMatches) Check(params []interface{}, _ []string) (result bool, error string) {
-	var obtained SimpleMessages
-	switch params[0].(type) {
+	var entries []loggo.Entry
+	switch param := params[0].(type) {
 	case []loggo.Entry:
-		obtained = logToSimpleMessages(params[0].([]loggo.Entry))
+		entries = param
+	case []slog.Record:
+		entries = make([]loggo.Entry, len(param))
+		for i, r := range param {
+			entries[i] = LogEntryFromSlog(r)
+		}
 	default:
-		return false, "Obtained value must be of type []loggo.Entry or SimpleMessage"
+		return false, "Obtained value must be of type []loggo.Entry, []slog.Record or SimpleMessage"
 	}
+	obtained := logToSimpleMessages(entries)
 
 	var expected SimpleMessages
 	switch param := params[1].(type) {
+	case []LogMatch:
+		return checkLogExpectation(entries, LogExpectation{Matches: param})
+	case LogExpectation:
+		return checkLogExpectation(entries, param)
 	case []SimpleMessage:
 		expected = SimpleMessages(param)
 	case SimpleMessages:
@@ -68,7 +80,7 @@ func (checker *logMatches) Check(params []interface{}, _ []string) (result bool,
 			}
 		}
 	default:
-		return false, "Expected value must be of type []string or []SimpleMessage"
+		return false, "Expected value must be of type []string, []SimpleMessage, []LogMatch or LogExpectation"
 	}
 
 	obtainedSinceLastMatch := obtained
@@ -103,6 +115,269 @@ func (checker *logMatches) Check(params []interface{}, _ []string) (result bool,
 //
 // The log may contain additional messages before and after each of the specified
 // expected messages.
+//
+// To match on other attributes of the log entries, pass a slice of LogMatch,
+// or a LogExpectation to also choose how the entries are matched.
+//
+// The log may also be a slice of slog.Record, in which case each record is
+// converted with LogEntryFromSlog before being matched.
 var LogMatches gc.Checker = &logMatches{
 	&gc.CheckerInfo{Name: "LogMatches", Params: []string{"obtained", "expected"}},
 }
+
+// LogMatch describes a log entry expected by LogMatches.
+// An entry matches if it satisfies all of the fields that are set.
+type LogMatch struct {
+	// Level, if set, must equal the level of the entry.
+	Level loggo.Level
+
+	// MinLevel and MaxLevel, if set, hold the lowest and
+	// highest levels that the entry may have.
+	MinLevel loggo.Level
+	MaxLevel loggo.Level
+
+	// Module, if set, must equal the module of the entry.
+	Module string
+
+	// ModulePrefix, if set, must equal the module of the
+	// entry or the module of one of its parents.
+	ModulePrefix string
+
+	// Labels, if set, must all be present in the labels
+	// of the entry with the same values. The entry may
+	// hold other labels too.
+	Labels map[string]string
+
+	// Message, if set, holds a regular expression that
+	// must match the message of the entry.
+	Message string
+
+	// Location, if set, holds a regular expression that
+	// must match the location of the entry, formatted
+	// as the base name of the file and the line number,
+	// for example "log.go:42".
+	Location string
+}
+
+// String returns a description of the fields of m that are set.
+func (m LogMatch) String() string {
+	var parts []string
+	if m.Level != loggo.UNSPECIFIED {
+		parts = append(parts, "level "+m.Level.String())
+	}
+	if m.MinLevel != loggo.UNSPECIFIED {
+		parts = append(parts, "level >= "+m.MinLevel.String())
+	}
+	if m.MaxLevel != loggo.UNSPECIFIED {
+		parts = append(parts, "level <= "+m.MaxLevel.String())
+	}
+	if m.Module != "" {
+		parts = append(parts, fmt.Sprintf("module %q", m.Module))
+	}
+	if m.ModulePrefix != "" {
+		parts = append(parts, fmt.Sprintf("module under %q", m.ModulePrefix))
+	}
+	if len(m.Labels) > 0 {
+		parts = append(parts, fmt.Sprintf("labels %v", m.Labels))
+	}
+	if m.Message != "" {
+		parts = append(parts, fmt.Sprintf("message %q", m.Message))
+	}
+	if m.Location != "" {
+		parts = append(parts, fmt.Sprintf("location %q", m.Location))
+	}
+	if len(parts) == 0 {
+		return "any entry"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// match reports whether the entry satisfies m.
+func (m LogMatch) match(entry loggo.Entry) (bool, error) {
+	if m.Level != loggo.UNSPECIFIED && entry.Level != m.Level {
+		return false, nil
+	}
+	if m.MinLevel != loggo.UNSPECIFIED && entry.Level < m.MinLevel {
+		return false, nil
+	}
+	if m.MaxLevel != loggo.UNSPECIFIED && entry.Level > m.MaxLevel {
+		return false, nil
+	}
+	if m.Module != "" && entry.Module != m.Module {
+		return false, nil
+	}
+	if m.ModulePrefix != "" && entry.Module != m.ModulePrefix && !strings.HasPrefix(entry.Module, m.ModulePrefix+".") {
+		return false, nil
+	}
+	for name, value := range m.Labels {
+		if v, ok := entry.Labels[name]; !ok || v != value {
+			return false, nil
+		}
+	}
+	if m.Message != "" {
+		matched, err := regexp.MatchString(m.Message, entry.Message)
+		if err != nil {
+			return false, fmt.Errorf("bad message regexp %q: %v", m.Message, err)
+		}
+		if !matched {
+			return false, nil
+		}
+	}
+	if m.Location != "" {
+		location := fmt.Sprintf("%s:%d", filepath.Base(entry.Filename), entry.Line)
+		matched, err := regexp.MatchString(m.Location, location)
+		if err != nil {
+			return false, fmt.Errorf("bad location regexp %q: %v", m.Location, err)
+		}
+		if !matched {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// LogMatchMode determines how the entries of a LogExpectation
+// are matched against a log.
+type LogMatchMode int
+
+const (
+	// LogMatchSubsequence requires the expected entries to match
+	// entries in the log in the order given. The log may hold
+	// other entries before, between and after them. This is the
+	// default, and is how LogMatches treats all other values.
+	LogMatchSubsequence LogMatchMode = iota
+
+	// LogMatchConsecutive requires the expected entries to match
+	// consecutive entries in the log, in the order given. The log
+	// may hold other entries before and after them.
+	LogMatchConsecutive
+
+	// LogMatchUnordered requires each expected entry to match a
+	// different entry in the log, in any order. The log may hold
+	// other entries.
+	LogMatchUnordered
+
+	// LogMatchExact requires the log to hold exactly as many
+	// entries as are expected, each matching the expected entry
+	// in the same position.
+	LogMatchExact
+)
+
+// String implements fmt.Stringer.
+func (mode LogMatchMode) String() string {
+	switch mode {
+	case LogMatchSubsequence:
+		return "subsequence"
+	case LogMatchConsecutive:
+		return "consecutive"
+	case LogMatchUnordered:
+		return "unordered"
+	case LogMatchExact:
+		return "exact"
+	}
+	return fmt.Sprintf("LogMatchMode(%d)", int(mode))
+}
+
+// LogExpectation holds the entries expected by LogMatches
+// and how they should be matched.
+type LogExpectation struct {
+	Mode    LogMatchMode
+	Matches []LogMatch
+}
+
+// checkLogExpectation implements LogMatches for LogExpectation.
+func checkLogExpectation(entries []loggo.Entry, expect LogExpectation) (bool, string) {
+	// Work out which entries match each expectation up front,
+	// which means that bad regexps are reported even when they
+	// would not otherwise be used.
+	matches := make([][]bool, len(expect.Matches))
+	for i, m := range expect.Matches {
+		matches[i] = make([]bool, len(entries))
+		for j, entry := range entries {
+			ok, err := m.match(entry)
+			if err != nil {
+				return false, err.Error()
+			}
+			matches[i][j] = ok
+		}
+	}
+	switch expect.Mode {
+	case LogMatchSubsequence:
+		j := 0
+		for i := range expect.Matches {
+			for j < len(entries) && !matches[i][j] {
+				j++
+			}
+			if j == len(entries) {
+				return false, fmt.Sprintf("no entry matches expectation %d (%v) in order", i, expect.Matches[i])
+			}
+			j++
+		}
+		return true, ""
+	case LogMatchConsecutive:
+		if len(expect.Matches) == 0 {
+			return true, ""
+		}
+	next:
+		for start := 0; start+len(expect.Matches) <= len(entries); start++ {
+			for i := range expect.Matches {
+				if !matches[i][start+i] {
+					continue next
+				}
+			}
+			return true, ""
+		}
+		return false, fmt.Sprintf("no %d consecutive entries match the expectations", len(expect.Matches))
+	case LogMatchUnordered:
+		if i := unmatchedExpectation(matches, len(entries)); i != -1 {
+			return false, fmt.Sprintf("no distinct entry matches expectation %d (%v)", i, expect.Matches[i])
+		}
+		return true, ""
+	case LogMatchExact:
+		if len(entries) != len(expect.Matches) {
+			return false, fmt.Sprintf("expected %d entries, got %d", len(expect.Matches), len(entries))
+		}
+		for i := range expect.Matches {
+			if !matches[i][i] {
+				return false, fmt.Sprintf("entry %d does not match expectation (%v)", i, expect.Matches[i])
+			}
+		}
+		return true, ""
+	}
+	return false, fmt.Sprintf("unknown log match mode %v", expect.Mode)
+}
+
+// unmatchedExpectation tries to assign a different entry to each
+// expectation, where matches[i][j] holds whether expectation i
+// matches entry j. It returns the index of the first expectation
+// that cannot be assigned an entry, or -1 if all of them can.
+func unmatchedExpectation(matches [][]bool, numEntries int) int {
+	// assigned holds, for each entry, the index of the
+	// expectation it has been assigned to, or -1.
+	assigned := make([]int, numEntries)
+	for j := range assigned {
+		assigned[j] = -1
+	}
+	// assign finds an entry for expectation i, reassigning
+	// previously assigned entries if necessary.
+	var assign func(i int, seen []bool) bool
+	assign = func(i int, seen []bool) bool {
+		for j := 0; j < numEntries; j++ {
+			if !matches[i][j] || seen[j] {
+				continue
+			}
+			seen[j] = true
+			if assigned[j] == -1 || assign(assigned[j], seen) {
+				assigned[j] = i
+				return true
+			}
+		}
+		return false
+	}
+	for i := range matches {
+		if !assign(i, make([]bool, numEntries)) {
+			return i
+		}
+	}
+	return -1
+}
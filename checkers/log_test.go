@@ -169,7 +169,7 @@ func (s *LogMatchesSuite) TestLogMatchesOnlyAcceptsSliceTestLogValues(c *gc.C) {
 	expected := jc.SimpleMessages{}
 	result, err := jc.LogMatches.Check([]interface{}{obtained, expected}, nil)
 	c.Assert(result, gc.Equals, false)
-	c.Assert(err, gc.Equals, "Obtained value must be of type []loggo.Entry or SimpleMessage")
+	c.Assert(err, gc.Equals, "Obtained value must be of type []loggo.Entry, []slog.Record or SimpleMessage")
 }
 
 func (s *LogMatchesSuite) TestLogMatchesOnlyAcceptsStringOrSimpleMessages(c *gc.C) {
@@ -181,7 +181,7 @@ func (s *LogMatchesSuite) TestLogMatchesOnlyAcceptsStringOrSimpleMessages(c *gc.
 	expected := "totally wrong"
 	result, err := jc.LogMatches.Check([]interface{}{obtained, expected}, nil)
 	c.Assert(result, gc.Equals, false)
-	c.Assert(err, gc.Equals, "Expected value must be of type []string or []SimpleMessage")
+	c.Assert(err, gc.Equals, "Expected value must be of type []string, []SimpleMessage, []LogMatch or LogExpectation")
 }
 
 func (s *LogMatchesSuite) TestLogMatchesFailsOnInvalidRegex(c *gc.C) {
@@ -192,3 +192,122 @@ func (s *LogMatchesSuite) TestLogMatchesFailsOnInvalidRegex(c *gc.C) {
 	c.Assert(result, gc.Equals, false)
 	c.Assert(err, gc.Equals, "bad message regexp \"[]foo\": error parsing regexp: missing closing ]: `[]foo`")
 }
+
+type LogMatchSuite struct{}
+
+var _ = gc.Suite(&LogMatchSuite{})
+
+var structuredLog = []loggo.Entry{{
+	Level:    loggo.INFO,
+	Module:   "juju.worker",
+	Filename: "/src/juju/worker/worker.go",
+	Line:     10,
+	Message:  "starting",
+	Labels:   loggo.Labels{"model": "foo", "domain": "workers"},
+}, {
+	Level:    loggo.DEBUG,
+	Module:   "juju.worker.uniter",
+	Filename: "/src/juju/worker/uniter/uniter.go",
+	Line:     20,
+	Message:  "hook ran",
+	Labels:   loggo.Labels{"model": "foo"},
+}, {
+	Level:    loggo.ERROR,
+	Module:   "juju.apiserver",
+	Filename: "/src/juju/apiserver/server.go",
+	Line:     30,
+	Message:  "cannot connect",
+}}
+
+func (s *LogMatchSuite) TestMatchFields(c *gc.C) {
+	c.Check(structuredLog, jc.LogMatches, []jc.LogMatch{
+		{Module: "juju.worker"},
+		{Module: "juju.apiserver"},
+	})
+	c.Check(structuredLog, gc.Not(jc.LogMatches), []jc.LogMatch{
+		{Module: "juju"},
+	})
+	c.Check(structuredLog, jc.LogMatches, []jc.LogMatch{
+		{ModulePrefix: "juju.worker", Message: "hook"},
+	})
+	c.Check(structuredLog, gc.Not(jc.LogMatches), []jc.LogMatch{
+		{ModulePrefix: "juju.work"},
+	})
+	c.Check(structuredLog, jc.LogMatches, []jc.LogMatch{
+		{Labels: map[string]string{"domain": "workers"}},
+		{Labels: map[string]string{"model": "foo"}},
+	})
+	c.Check(structuredLog, gc.Not(jc.LogMatches), []jc.LogMatch{
+		{Labels: map[string]string{"model": "bar"}},
+	})
+	c.Check(structuredLog, jc.LogMatches, []jc.LogMatch{
+		{MinLevel: loggo.WARNING, Message: "cannot"},
+	})
+	c.Check(structuredLog, gc.Not(jc.LogMatches), []jc.LogMatch{
+		{MaxLevel: loggo.INFO, Message: "cannot"},
+	})
+	c.Check(structuredLog, jc.LogMatches, []jc.LogMatch{
+		{Level: loggo.DEBUG, Location: `^uniter\.go:20$`},
+	})
+	c.Check(structuredLog, gc.Not(jc.LogMatches), []jc.LogMatch{
+		{Level: loggo.INFO, Location: `^uniter\.go:20$`},
+	})
+}
+
+func (s *LogMatchSuite) TestMatchModes(c *gc.C) {
+	starting := jc.LogMatch{Message: "starting"}
+	hook := jc.LogMatch{Message: "hook"}
+	cannot := jc.LogMatch{Message: "cannot"}
+	any := jc.LogMatch{}
+
+	for i, test := range []struct {
+		mode    jc.LogMatchMode
+		matches []jc.LogMatch
+		ok      bool
+	}{
+		{jc.LogMatchSubsequence, []jc.LogMatch{starting, cannot}, true},
+		{jc.LogMatchSubsequence, []jc.LogMatch{cannot, starting}, false},
+		{jc.LogMatchConsecutive, []jc.LogMatch{hook, cannot}, true},
+		{jc.LogMatchConsecutive, []jc.LogMatch{starting, cannot}, false},
+		{jc.LogMatchConsecutive, nil, true},
+		{jc.LogMatchUnordered, []jc.LogMatch{cannot, starting}, true},
+		{jc.LogMatchUnordered, []jc.LogMatch{cannot, cannot}, false},
+		// The first expectation could take any entry, so
+		// entries must be reassigned to satisfy them all.
+		{jc.LogMatchUnordered, []jc.LogMatch{any, hook, starting}, true},
+		{jc.LogMatchExact, []jc.LogMatch{starting, hook, cannot}, true},
+		{jc.LogMatchExact, []jc.LogMatch{starting, cannot}, false},
+		{jc.LogMatchExact, []jc.LogMatch{hook, starting, cannot}, false},
+	} {
+		c.Logf("test %d: %v %v", i, test.mode, test.matches)
+		ok, _ := jc.LogMatches.Check([]interface{}{structuredLog, jc.LogExpectation{
+			Mode:    test.mode,
+			Matches: test.matches,
+		}}, nil)
+		c.Check(ok, gc.Equals, test.ok)
+	}
+}
+
+func (s *LogMatchSuite) TestMismatchError(c *gc.C) {
+	ok, err := jc.LogMatches.Check([]interface{}{structuredLog, jc.LogExpectation{
+		Mode:    jc.LogMatchExact,
+		Matches: []jc.LogMatch{{Module: "juju.worker"}, {Level: loggo.DEBUG}, {Level: loggo.INFO, Message: "foo"}},
+	}}, nil)
+	c.Check(ok, gc.Equals, false)
+	c.Check(err, gc.Equals, `entry 2 does not match expectation (level INFO, message "foo")`)
+
+	ok, err = jc.LogMatches.Check([]interface{}{structuredLog, []jc.LogMatch{
+		{Location: "[]"},
+	}}, nil)
+	c.Check(ok, gc.Equals, false)
+	c.Check(err, gc.Equals, "bad location regexp \"[]\": error parsing regexp: missing closing ]: `[]`")
+}
+
+func (s *LogMatchSuite) TestLogMatchString(c *gc.C) {
+	c.Check(jc.LogMatch{}.String(), gc.Equals, "any entry")
+	c.Check(jc.LogMatch{
+		MinLevel:     loggo.INFO,
+		ModulePrefix: "juju",
+		Labels:       map[string]string{"a": "b"},
+	}.String(), gc.Equals, `level >= INFO, module under "juju", labels map[a:b]`)
+}
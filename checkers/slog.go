@@ -0,0 +1,98 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package checkers
+
+import (
+	"log/slog"
+	"runtime"
+
+	"github.com/juju/loggo/v2"
+)
+
+// SlogModule is the module given to log entries converted
+// from slog records by LogEntryFromSlog.
+const SlogModule = "slog"
+
+// LogEntryFromSlog converts an slog record to the loggo entry that
+// LogMatches checks it as. The attributes of the record become the
+// labels of the entry, with the names of any groups they are in
+// prefixed to their keys, separated by dots.
+func LogEntryFromSlog(r slog.Record) loggo.Entry {
+	entry := loggo.Entry{
+		Level:     LevelFromSlog(r.Level),
+		Module:    SlogModule,
+		Timestamp: r.Time,
+		Message:   r.Message,
+	}
+	if r.PC != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+		entry.Filename = frame.File
+		entry.Line = frame.Line
+	}
+	if r.NumAttrs() > 0 {
+		entry.Labels = make(loggo.Labels)
+		r.Attrs(func(attr slog.Attr) bool {
+			addSlogLabels(entry.Labels, "", attr)
+			return true
+		})
+	}
+	return entry
+}
+
+func addSlogLabels(labels loggo.Labels, prefix string, attr slog.Attr) {
+	value := attr.Value.Resolve()
+	if value.Kind() != slog.KindGroup {
+		if attr.Key != "" {
+			labels[prefix+attr.Key] = value.String()
+		}
+		return
+	}
+	if attr.Key != "" {
+		prefix += attr.Key + "."
+	}
+	for _, attr := range value.Group() {
+		addSlogLabels(labels, prefix, attr)
+	}
+}
+
+// LevelFromSlog returns the loggo level corresponding to the
+// given slog level, as returned by LevelToSlog. Levels between
+// those are rounded down, so that, for example, any level from
+// slog.LevelError up to the level of CRITICAL maps to ERROR.
+func LevelFromSlog(level slog.Level) loggo.Level {
+	switch {
+	case level < slog.LevelDebug:
+		return loggo.TRACE
+	case level < slog.LevelInfo:
+		return loggo.DEBUG
+	case level < slog.LevelWarn:
+		return loggo.INFO
+	case level < slog.LevelError:
+		return loggo.WARNING
+	case level < LevelToSlog(loggo.CRITICAL):
+		return loggo.ERROR
+	}
+	return loggo.CRITICAL
+}
+
+// LevelToSlog returns the slog level corresponding
+// to the given loggo level.
+func LevelToSlog(level loggo.Level) slog.Level {
+	switch level {
+	case loggo.TRACE:
+		return slog.LevelDebug - 4
+	case loggo.DEBUG:
+		return slog.LevelDebug
+	case loggo.INFO:
+		return slog.LevelInfo
+	case loggo.WARNING:
+		return slog.LevelWarn
+	case loggo.ERROR:
+		return slog.LevelError
+	case loggo.CRITICAL:
+		return slog.LevelError + 4
+	}
+	// UNSPECIFIED enables everything.
+	return slog.LevelDebug - 8
+}
@@ -0,0 +1,77 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package checkers_test
+
+import (
+	"log/slog"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/juju/loggo/v2"
+	gc "gopkg.in/check.v1"
+
+	jc "github.com/juju/testing/checkers"
+)
+
+type SlogSuite struct{}
+
+var _ = gc.Suite(&SlogSuite{})
+
+func (s *SlogSuite) TestLogEntryFromSlog(c *gc.C) {
+	now := time.Now()
+	pc, _, line, _ := runtime.Caller(0)
+	r := slog.NewRecord(now, slog.LevelWarn, "hello", pc)
+	r.AddAttrs(
+		slog.String("name", "value"),
+		slog.Int("count", 3),
+		slog.Group("req", slog.String("method", "GET"), slog.Group("url", slog.String("path", "/x"))),
+		slog.Group("", slog.Bool("inline", true)),
+	)
+	entry := jc.LogEntryFromSlog(r)
+	c.Check(filepath.Base(entry.Filename), gc.Equals, "slog_test.go")
+	c.Check(entry.Line, gc.Equals, line)
+	entry.Filename, entry.Line = "", 0
+	c.Check(entry, jc.DeepEquals, loggo.Entry{
+		Level:     loggo.WARNING,
+		Module:    jc.SlogModule,
+		Timestamp: now,
+		Message:   "hello",
+		Labels: loggo.Labels{
+			"name":         "value",
+			"count":        "3",
+			"req.method":   "GET",
+			"req.url.path": "/x",
+			"inline":       "true",
+		},
+	})
+}
+
+func (s *SlogSuite) TestLevels(c *gc.C) {
+	for _, level := range []loggo.Level{
+		loggo.TRACE, loggo.DEBUG, loggo.INFO, loggo.WARNING, loggo.ERROR, loggo.CRITICAL,
+	} {
+		c.Check(jc.LevelFromSlog(jc.LevelToSlog(level)), gc.Equals, level)
+	}
+	c.Check(jc.LevelFromSlog(slog.LevelInfo+1), gc.Equals, loggo.INFO)
+	c.Check(jc.LevelFromSlog(slog.LevelDebug-1), gc.Equals, loggo.TRACE)
+	c.Check(jc.LevelFromSlog(slog.LevelError+1), gc.Equals, loggo.ERROR)
+	c.Check(jc.LevelFromSlog(slog.LevelError+8), gc.Equals, loggo.CRITICAL)
+}
+
+func (s *SlogSuite) TestLogMatchesSlogRecords(c *gc.C) {
+	records := []slog.Record{
+		slog.NewRecord(time.Now(), slog.LevelInfo, "starting", 0),
+		slog.NewRecord(time.Now(), slog.LevelError, "cannot connect", 0),
+	}
+	records[1].AddAttrs(slog.String("addr", "10.0.0.1"))
+	c.Check(records, jc.LogMatches, []string{"starting", "cannot"})
+	c.Check(records, jc.LogMatches, []jc.LogMatch{{
+		Level:  loggo.ERROR,
+		Labels: map[string]string{"addr": "10.0.0.1"},
+	}})
+	c.Check(records, gc.Not(jc.LogMatches), []jc.SimpleMessage{
+		{Level: loggo.WARNING, Message: "cannot"},
+	})
+}
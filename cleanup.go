@@ -138,3 +138,15 @@ func (s *CleanupSuite) HookCommandOutput(
 	s.AddCleanup(func(*gc.C) { restore() })
 	return result
 }
+
+// HookCommandOutputRules calls the package function of the same name
+// to replace the function with one whose results are determined by
+// the given rules, and will call the restore function on test teardown.
+func (s *CleanupSuite) HookCommandOutputRules(
+	outputFunc *func(cmd *exec.Cmd) ([]byte, error),
+	rules ...CommandRule,
+) *CommandOutputHook {
+	hook, restore := HookCommandOutputRules(outputFunc, rules...)
+	s.AddCleanup(func(*gc.C) { restore() })
+	return hook
+}
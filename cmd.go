@@ -4,14 +4,21 @@
 package testing
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
+	"regexp"
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/juju/utils/v4"
 	gc "gopkg.in/check.v1"
@@ -41,6 +48,179 @@ func HookCommandOutput(
 	return cmdChan, cleanup
 }
 
+// CommandRule determines the result of running the commands it
+// matches when installed with HookCommandOutputRules. A command
+// matches if it satisfies all of the fields that are set.
+type CommandRule struct {
+	// Path, if set, must equal either the path of the command
+	// or the name it was created with (its first argument).
+	Path string
+
+	// PathPattern, if set, holds a regular expression that
+	// must match the whole path of the command.
+	PathPattern string
+
+	// Args, if not nil, must equal the arguments of the
+	// command, not including the command name.
+	Args []string
+
+	// ArgsPattern, if set, holds a regular expression that
+	// must match the whole of the arguments of the command,
+	// not including the command name, joined with spaces.
+	ArgsPattern string
+
+	// Output and Err hold the values returned for
+	// matching commands.
+	Output []byte
+	Err    error
+}
+
+// String returns a description of the commands matched by the rule.
+func (r CommandRule) String() string {
+	var parts []string
+	if r.Path != "" {
+		parts = append(parts, fmt.Sprintf("path %q", r.Path))
+	}
+	if r.PathPattern != "" {
+		parts = append(parts, fmt.Sprintf("path matching %q", r.PathPattern))
+	}
+	if r.Args != nil {
+		parts = append(parts, fmt.Sprintf("args %q", r.Args))
+	}
+	if r.ArgsPattern != "" {
+		parts = append(parts, fmt.Sprintf("args matching %q", r.ArgsPattern))
+	}
+	if len(parts) == 0 {
+		return "any command"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// commandRule holds a CommandRule with its patterns compiled.
+type commandRule struct {
+	CommandRule
+	pathPattern *regexp.Regexp
+	argsPattern *regexp.Regexp
+}
+
+func (r *commandRule) match(cmd *exec.Cmd) bool {
+	var name string
+	var args []string
+	if len(cmd.Args) > 0 {
+		name, args = cmd.Args[0], cmd.Args[1:]
+	}
+	if r.Path != "" && r.Path != cmd.Path && r.Path != name {
+		return false
+	}
+	if r.pathPattern != nil && !r.pathPattern.MatchString(cmd.Path) {
+		return false
+	}
+	if r.Args != nil && strings.Join(r.Args, "\x00") != strings.Join(args, "\x00") {
+		return false
+	}
+	if r.argsPattern != nil && !r.argsPattern.MatchString(strings.Join(args, " ")) {
+		return false
+	}
+	return true
+}
+
+// CommandOutputHook holds the rules and records the commands
+// of a function hooked by HookCommandOutputRules. It is safe
+// to use concurrently.
+type CommandOutputHook struct {
+	// mu guards the fields below it.
+	mu sync.Mutex
+	// rules holds the rules in the order they were added.
+	rules []*commandRule
+	// hits holds the number of commands that matched each rule.
+	hits []int
+	// cmds holds all the commands run, in order.
+	cmds []*exec.Cmd
+	// unmatched holds the commands that matched no rule.
+	unmatched []*exec.Cmd
+}
+
+// HookCommandOutputRules replaces the function pointed to by outputFunc
+// with one that records each command it is given and returns the output
+// and error of the first of the given rules that matches the command.
+// If no rule matches, it returns an error saying so. Unlike
+// HookCommandOutput, there is no limit to the number of commands
+// recorded. It returns the hook, which can be used to add more
+// rules and inspect the commands, and a function that restores
+// the original function.
+func HookCommandOutputRules(
+	outputFunc *func(cmd *exec.Cmd) ([]byte, error), rules ...CommandRule,
+) (*CommandOutputHook, Restorer) {
+	hook := &CommandOutputHook{}
+	for _, rule := range rules {
+		hook.AddRule(rule)
+	}
+	restore := PatchValue(outputFunc, hook.output)
+	return hook, restore
+}
+
+// AddRule adds a rule to the hook. Rules are tried in the
+// order they were added. It panics if either of the patterns
+// of the rule is not a valid regular expression.
+func (h *CommandOutputHook) AddRule(rule CommandRule) {
+	r := &commandRule{CommandRule: rule}
+	if rule.PathPattern != "" {
+		r.pathPattern = regexp.MustCompile("^(?:" + rule.PathPattern + ")$")
+	}
+	if rule.ArgsPattern != "" {
+		r.argsPattern = regexp.MustCompile("^(?:" + rule.ArgsPattern + ")$")
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.rules = append(h.rules, r)
+	h.hits = append(h.hits, 0)
+}
+
+func (h *CommandOutputHook) output(cmd *exec.Cmd) ([]byte, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.cmds = append(h.cmds, cmd)
+	for i, r := range h.rules {
+		if r.match(cmd) {
+			h.hits[i]++
+			return r.Output, r.Err
+		}
+	}
+	h.unmatched = append(h.unmatched, cmd)
+	return nil, fmt.Errorf("no rule matches command %q", cmd.Args)
+}
+
+// Commands returns all the commands that have been run
+// through the hooked function, in order.
+func (h *CommandOutputHook) Commands() []*exec.Cmd {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	cmds := make([]*exec.Cmd, len(h.cmds))
+	copy(cmds, h.cmds)
+	return cmds
+}
+
+// Verify returns an error describing any rules that have not
+// matched a command, and any commands that matched no rule.
+// It returns nil if there are none.
+func (h *CommandOutputHook) Verify() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var problems []string
+	for i, r := range h.rules {
+		if h.hits[i] == 0 {
+			problems = append(problems, fmt.Sprintf("rule %d (%v) matched no commands", i, r.CommandRule))
+		}
+	}
+	for _, cmd := range h.unmatched {
+		problems = append(problems, fmt.Sprintf("command %q matched no rule", cmd.Args))
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s", strings.Join(problems, "\n"))
+}
+
 const (
 	// EchoQuotedArgs is a simple bash script that prints out the
 	// basename of the command followed by the args as quoted strings.
@@ -214,6 +394,23 @@ type PatchExecConfig struct {
 	Stdout string
 	// ExitCode controls the exit code of the patched executable.
 	ExitCode int
+	// EchoStdin causes the patched executable to copy its standard
+	// input to its standard output, after writing Stdout.
+	EchoStdin bool
+	// Delay holds the time that the patched executable waits
+	// before writing its output, as FakeExecResponse.Delay does.
+	Delay time.Duration
+	// WaitForSignal causes the patched executable to wait, after
+	// writing its output, until it receives an interrupt or
+	// termination signal before exiting with ExitCode. The signal
+	// handler is installed before any output is written, so a test
+	// can safely send the signal once it has read the output.
+	WaitForSignal bool
+	// Commands holds configurations to use instead of this one
+	// for particular commands, keyed by the command name passed
+	// to the patched execCommand function. The Args and Commands
+	// fields of these configurations are ignored.
+	Commands map[string]PatchExecConfig
 	// Args is a channel that will be sent the args passed to the patched
 	// execCommand function.  It should be a channel with a buffer equal to the
 	// number of executions you expect to be run (often just 1).  Do not use an
@@ -222,6 +419,33 @@ type PatchExecConfig struct {
 	Args chan<- []string
 }
 
+// execHelperConfig holds the behaviour of a single helper
+// process, as passed to it in the JUJU_HELPER_PROCESS_CONFIG
+// environment variable.
+type execHelperConfig struct {
+	Stdout        string        `json:"stdout,omitempty"`
+	Stderr        string        `json:"stderr,omitempty"`
+	ExitCode      int           `json:"exit-code,omitempty"`
+	EchoStdin     bool          `json:"echo-stdin,omitempty"`
+	Delay         time.Duration `json:"delay,omitempty"`
+	WaitForSignal bool          `json:"wait-for-signal,omitempty"`
+}
+
+// helperConfig returns the configuration to use for the given command.
+func (cfg PatchExecConfig) helperConfig(command string) execHelperConfig {
+	if commandCfg, ok := cfg.Commands[command]; ok {
+		cfg = commandCfg
+	}
+	return execHelperConfig{
+		Stdout:        cfg.Stdout,
+		Stderr:        cfg.Stderr,
+		ExitCode:      cfg.ExitCode,
+		EchoStdin:     cfg.EchoStdin,
+		Delay:         cfg.Delay,
+		WaitForSignal: cfg.WaitForSignal,
+	}
+}
+
 // GetExecCommand returns a function that can be used to patch out a use of
 // exec.Command. See PatchExecConfig for details about the arguments.
 func (PatchExecHelper) GetExecCommand(cfg PatchExecConfig) func(string, ...string) *exec.Cmd {
@@ -236,20 +460,25 @@ func (PatchExecHelper) GetExecCommand(cfg PatchExecConfig) func(string, ...strin
 		// even if you have more than one suite embedding PatchExecHelper, all
 		// the tests have the same imlpementation, and the first instance of the
 		// test to run calls os.Exit, and therefore none of the other tests will
-		// run.
+		// run. If the test executable calls RunExecHelperProcess from TestMain
+		// instead, the arguments are never parsed at all.
 		cs := []string{"-check.f=TestExecSuiteHelperProcess", "--", command}
 		cs = append(cs, args...)
 		cmd := exec.Command(os.Args[0], cs...)
 
+		data, err := json.Marshal(cfg.helperConfig(command))
+		if err != nil {
+			// This should be impossible, since the config
+			// holds only strings, numbers and booleans.
+			panic(err)
+		}
 		cmd.Env = append(
 			// We must preserve os.Environ() on Windows,
 			// or the subprocess will fail in weird and
 			// wonderful ways.
 			os.Environ(),
 			"JUJU_WANT_HELPER_PROCESS=1",
-			"JUJU_HELPER_PROCESS_STDERR="+cfg.Stderr,
-			"JUJU_HELPER_PROCESS_STDOUT="+cfg.Stdout,
-			fmt.Sprintf("JUJU_HELPER_PROCESS_EXITCODE=%d", cfg.ExitCode),
+			"JUJU_HELPER_PROCESS_CONFIG="+string(data),
 		)
 
 		// Pass the args back on the arg channel. This is why the channel needs
@@ -270,26 +499,59 @@ func (PatchExecHelper) GetExecCommand(cfg PatchExecConfig) func(string, ...strin
 // behavior.  Because the test exits with os.Exit, no additional test output is
 // written.
 func (PatchExecHelper) TestExecSuiteHelperProcess(c *gc.C) {
+	RunExecHelperProcess()
+}
+
+// RunExecHelperProcess behaves as configured by PatchExecConfig and exits
+// if the current process was started by a function returned from
+// PatchExecHelper.GetExecCommand, and acts as the fake executable and
+// exits if the current process is one created by PatchFakeExecutable
+// or PatchExecutablePassthrough. Otherwise it does nothing.
+//
+// Test executables that use fake executables, that do not run their
+// tests with gocheck, or that filter the gocheck tests they run, must
+// call it from TestMain before calling m.Run:
+//
+//	func TestMain(m *testing.M) {
+//		testing.RunExecHelperProcess()
+//		os.Exit(m.Run())
+//	}
+func RunExecHelperProcess() {
+	runFakeExecutableIfConfigured()
 	if os.Getenv("JUJU_WANT_HELPER_PROCESS") == "" {
 		return
 	}
-	if stderr := os.Getenv("JUJU_HELPER_PROCESS_STDERR"); stderr != "" {
-		fmt.Fprintln(os.Stderr, stderr)
+	var cfg execHelperConfig
+	if err := json.Unmarshal([]byte(os.Getenv("JUJU_HELPER_PROCESS_CONFIG")), &cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "cannot parse helper process config: %v\n", err)
+		os.Exit(2)
 	}
-	if stdout := os.Getenv("JUJU_HELPER_PROCESS_STDOUT"); stdout != "" {
-		fmt.Fprintln(os.Stdout, stdout)
+	os.Exit(runExecHelperProcess(cfg))
+}
+
+func runExecHelperProcess(cfg execHelperConfig) int {
+	var signals chan os.Signal
+	if cfg.WaitForSignal {
+		signals = make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
 	}
-	code := os.Getenv("JUJU_HELPER_PROCESS_EXITCODE")
-	if code == "" {
-		os.Exit(0)
+	time.Sleep(cfg.Delay)
+	if cfg.Stderr != "" {
+		fmt.Fprintln(os.Stderr, cfg.Stderr)
 	}
-	exit, err := strconv.Atoi(code)
-	if err != nil {
-		// This should be impossible, since we set this with an int above.
-		panic(err)
+	if cfg.Stdout != "" {
+		fmt.Fprintln(os.Stdout, cfg.Stdout)
 	}
-	os.Exit(exit)
-
+	if cfg.EchoStdin {
+		if _, err := io.Copy(os.Stdout, os.Stdin); err != nil {
+			fmt.Fprintf(os.Stderr, "cannot echo stdin: %v\n", err)
+			return 2
+		}
+	}
+	if signals != nil {
+		<-signals
+	}
+	return cfg.ExitCode
 }
 
 // CaptureOutput runs the given function and captures anything written
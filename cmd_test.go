@@ -4,11 +4,14 @@
 package testing_test
 
 import (
+	"bufio"
 	"bytes"
 	"fmt"
 	"os"
 	"os/exec"
+	"runtime"
 	"strings"
+	"time"
 
 	gc "gopkg.in/check.v1"
 
@@ -36,6 +39,90 @@ func (s *cmdSuite) TestHookCommandOutput(c *gc.C) {
 	c.Assert(cmd.Args, gc.DeepEquals, []string{"fake-command", "arg1", "arg2"})
 }
 
+func (s *cmdSuite) TestHookCommandOutputRules(c *gc.C) {
+	var CommandOutput = (*exec.Cmd).CombinedOutput
+
+	hook := s.HookCommandOutputRules(&CommandOutput,
+		testing.CommandRule{
+			Path:   "git",
+			Args:   []string{"status"},
+			Output: []byte("clean"),
+		},
+		testing.CommandRule{
+			PathPattern: ".*/?git",
+			ArgsPattern: "push .*",
+			Err:         fmt.Errorf("rejected"),
+		},
+	)
+	hook.AddRule(testing.CommandRule{
+		Path:   "git",
+		Output: []byte("other"),
+	})
+
+	out, err := CommandOutput(exec.Command("git", "status"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(out), gc.Equals, "clean")
+
+	_, err = CommandOutput(exec.Command("git", "push", "origin", "main"))
+	c.Check(err, gc.ErrorMatches, "rejected")
+
+	out, err = CommandOutput(exec.Command("git", "log"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(out), gc.Equals, "other")
+
+	c.Check(hook.Verify(), jc.ErrorIsNil)
+	var args [][]string
+	for _, cmd := range hook.Commands() {
+		args = append(args, cmd.Args)
+	}
+	c.Check(args, jc.DeepEquals, [][]string{
+		{"git", "status"},
+		{"git", "push", "origin", "main"},
+		{"git", "log"},
+	})
+}
+
+func (s *cmdSuite) TestHookCommandOutputRulesUnbounded(c *gc.C) {
+	var CommandOutput = (*exec.Cmd).CombinedOutput
+
+	hook := s.HookCommandOutputRules(&CommandOutput, testing.CommandRule{})
+	for i := 0; i < testing.HookChannelSize*2; i++ {
+		_, err := CommandOutput(exec.Command("fake-command", fmt.Sprint(i)))
+		c.Assert(err, jc.ErrorIsNil)
+	}
+	c.Check(hook.Commands(), gc.HasLen, testing.HookChannelSize*2)
+}
+
+func (s *cmdSuite) TestHookCommandOutputRulesVerify(c *gc.C) {
+	var CommandOutput = (*exec.Cmd).CombinedOutput
+
+	hook := s.HookCommandOutputRules(&CommandOutput,
+		testing.CommandRule{Path: "ls", Args: []string{}},
+		testing.CommandRule{Path: "rm", ArgsPattern: "-rf .*"},
+	)
+	_, err := CommandOutput(exec.Command("ls"))
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = CommandOutput(exec.Command("ls", "-l"))
+	c.Check(err, gc.ErrorMatches, `no rule matches command \["ls" "-l"\]`)
+
+	c.Check(hook.Verify(), gc.ErrorMatches, ``+
+		`rule 1 \(path "rm", args matching "-rf \.\*"\) matched no commands\n`+
+		`command \["ls" "-l"\] matched no rule`)
+}
+
+func (s *cmdSuite) TestHookCommandOutputRulesRestore(c *gc.C) {
+	var CommandOutput = func(*exec.Cmd) ([]byte, error) {
+		return []byte("original"), nil
+	}
+	_, restore := testing.HookCommandOutputRules(&CommandOutput)
+	_, err := CommandOutput(exec.Command("fake-command"))
+	c.Check(err, gc.ErrorMatches, `no rule matches command \["fake-command"\]`)
+	restore()
+	out, err := CommandOutput(exec.Command("fake-command"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(out), gc.Equals, "original")
+}
+
 func (s *cmdSuite) EnsureArgFileRemoved(name string) {
 	s.AddCleanup(func(c *gc.C) {
 		c.Assert(name+".out", jc.DoesNotExist)
@@ -156,6 +243,112 @@ func (s *ExecHelperSuite) TestExecHelper(c *gc.C) {
 	}
 }
 
+func (s *ExecHelperSuite) TestExecHelperMultiLine(c *gc.C) {
+	f := s.GetExecCommand(testing.PatchExecConfig{
+		Stdout: "line one\nline two",
+	})
+	out, err := f("echo").Output()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(out), gc.Equals, "line one\nline two\n")
+}
+
+func (s *ExecHelperSuite) TestExecHelperEchoStdin(c *gc.C) {
+	f := s.GetExecCommand(testing.PatchExecConfig{
+		Stdout:    "header",
+		EchoStdin: true,
+	})
+	cmd := f("cat")
+	cmd.Stdin = strings.NewReader("some\ninput")
+	out, err := cmd.Output()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(out), gc.Equals, "header\nsome\ninput")
+}
+
+func (s *ExecHelperSuite) TestExecHelperCommands(c *gc.C) {
+	argChan := make(chan []string, 2)
+	f := s.GetExecCommand(testing.PatchExecConfig{
+		Stdout: "default",
+		Commands: map[string]testing.PatchExecConfig{
+			"false": {ExitCode: 1, Stderr: "failed"},
+		},
+		Args: argChan,
+	})
+
+	out, err := f("true").Output()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(out), gc.Equals, "default\n")
+
+	var stderr bytes.Buffer
+	cmd := f("false", "now")
+	cmd.Stderr = &stderr
+	out, err = cmd.Output()
+	c.Check(err, gc.ErrorMatches, "exit status 1")
+	c.Check(string(out), gc.Equals, "")
+	c.Check(stderr.String(), gc.Equals, "failed\n")
+
+	c.Check(<-argChan, jc.DeepEquals, []string{"true"})
+	c.Check(<-argChan, jc.DeepEquals, []string{"false", "now"})
+}
+
+func (s *ExecHelperSuite) TestExecHelperDelay(c *gc.C) {
+	f := s.GetExecCommand(testing.PatchExecConfig{
+		Stdout: "late",
+		Delay:  100 * time.Millisecond,
+	})
+	cmd := f("sleep")
+	stdout, err := cmd.StdoutPipe()
+	c.Assert(err, jc.ErrorIsNil)
+	start := time.Now()
+	err = cmd.Start()
+	c.Assert(err, jc.ErrorIsNil)
+
+	// The delay comes before the output is written.
+	line, err := bufio.NewReader(stdout).ReadString('\n')
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(line, gc.Equals, "late\n")
+	c.Check(time.Since(start) >= 100*time.Millisecond, jc.IsTrue)
+	c.Assert(cmd.Wait(), jc.ErrorIsNil)
+}
+
+func (s *ExecHelperSuite) TestExecHelperWaitForSignal(c *gc.C) {
+	if runtime.GOOS == "windows" {
+		c.Skip("interrupt signals cannot be sent on windows")
+	}
+	f := s.GetExecCommand(testing.PatchExecConfig{
+		Stdout:        "ready",
+		ExitCode:      3,
+		WaitForSignal: true,
+	})
+	cmd := f("server")
+	stdout, err := cmd.StdoutPipe()
+	c.Assert(err, jc.ErrorIsNil)
+	err = cmd.Start()
+	c.Assert(err, jc.ErrorIsNil)
+
+	line, err := bufio.NewReader(stdout).ReadString('\n')
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(line, gc.Equals, "ready\n")
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+	select {
+	case err := <-done:
+		c.Fatalf("process exited before being signalled: %v", err)
+	case <-time.After(testing.ShortWait):
+	}
+
+	err = cmd.Process.Signal(os.Interrupt)
+	c.Assert(err, jc.ErrorIsNil)
+	select {
+	case err := <-done:
+		c.Check(err, gc.ErrorMatches, "exit status 3")
+	case <-time.After(testing.LongWait):
+		c.Fatalf("process did not exit after being signalled")
+	}
+}
+
 func runCommand(c *gc.C, command string, args ...string) string {
 	cmd := exec.Command(command, args...)
 	out, err := cmd.CombinedOutput()
@@ -0,0 +1,12 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package testing
+
+import "syscall"
+
+// dup2 makes newfd a copy of oldfd. Some Linux architectures
+// do not provide dup2, so dup3 is used instead.
+func dup2(oldfd, newfd int) error {
+	return syscall.Dup3(oldfd, newfd, 0)
+}
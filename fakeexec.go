@@ -0,0 +1,675 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package testing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	gc "gopkg.in/check.v1"
+
+	jc "github.com/juju/testing/checkers"
+)
+
+// FakeExecResponse determines how a fake executable created by
+// PatchFakeExecutable responds when it is run.
+type FakeExecResponse struct {
+	// Stdout holds the text written to standard output.
+	Stdout string `json:"stdout,omitempty"`
+
+	// Stderr holds the text written to standard error.
+	Stderr string `json:"stderr,omitempty"`
+
+	// ExitCode holds the exit code of the executable.
+	ExitCode int `json:"exit-code,omitempty"`
+
+	// Delay holds how long the executable waits before
+	// writing its output and exiting.
+	Delay time.Duration `json:"delay,omitempty"`
+
+	// ReadStdin determines whether the executable reads
+	// all of its standard input before responding. The
+	// input is recorded in FakeExecCall.Stdin.
+	ReadStdin bool `json:"read-stdin,omitempty"`
+
+	// LineDelay holds how long the executable waits after
+	// writing each line of its output, so that the output
+	// arrives slowly.
+	LineDelay time.Duration `json:"line-delay,omitempty"`
+
+	// WaitForRelease determines whether the executable waits,
+	// after writing its output, until FakeExecutable.Release
+	// is called before exiting.
+	WaitForRelease bool `json:"wait-for-release,omitempty"`
+
+	// IgnoreSignals holds signals that the executable records
+	// in FakeExecCall.Signals and otherwise ignores.
+	IgnoreSignals []syscall.Signal `json:"ignore-signals,omitempty"`
+
+	// TrapSignals holds signals that the executable records
+	// in FakeExecCall.Signals before exiting immediately with
+	// the exit code 128 plus the signal number, as a shell
+	// does. Signals in neither list have their default effect
+	// and are not recorded.
+	TrapSignals []syscall.Signal `json:"trap-signals,omitempty"`
+}
+
+// FakeExecCall records a single run of a fake executable.
+type FakeExecCall struct {
+	// Args holds the arguments the executable was run
+	// with, not including the name of the executable.
+	Args []string `json:"args"`
+
+	// Env holds the environment of the executable.
+	Env []string `json:"env"`
+
+	// Dir holds the working directory of the executable.
+	Dir string `json:"dir"`
+
+	// Stdin holds the standard input read by the
+	// executable, if FakeExecResponse.ReadStdin was set.
+	Stdin string `json:"stdin,omitempty"`
+
+	// ExitCode holds the exit code of the executable,
+	// or -1 if a passed through executable was
+	// terminated by a signal.
+	ExitCode int `json:"exit-code"`
+
+	// Duration holds how long the executable ran for.
+	Duration time.Duration `json:"duration"`
+
+	// Stdout and Stderr hold the output of a passed
+	// through executable, if it was created by
+	// PatchExecutablePassthroughWithOutput.
+	Stdout string `json:"stdout,omitempty"`
+	Stderr string `json:"stderr,omitempty"`
+
+	// Started holds the time that the executable started.
+	Started time.Time `json:"started"`
+
+	// Signals holds the signals received by the executable
+	// that it was configured to ignore or trap.
+	Signals []FakeExecSignal `json:"signals,omitempty"`
+
+	// Finished records whether the executable has finished.
+	// A run that is not finished is either still running
+	// or was killed; as SIGKILL cannot be caught, a test
+	// that expects its executable to be killed should check
+	// that the run did not finish once the process has gone.
+	Finished bool `json:"finished"`
+}
+
+// FakeExecSignal records a signal received by a fake executable.
+type FakeExecSignal struct {
+	Signal syscall.Signal `json:"signal"`
+	Time   time.Time      `json:"time"`
+}
+
+// fakeExecEvent holds one of the events that a fake executable
+// records for each run, as a line of JSON in its call file. The
+// events are written as they happen, so that a run that does not
+// finish is still recorded.
+type fakeExecEvent struct {
+	Started  *FakeExecCall   `json:"started,omitempty"`
+	Signal   *FakeExecSignal `json:"signal,omitempty"`
+	Finished *FakeExecCall   `json:"finished,omitempty"`
+}
+
+// Getenv returns the value of the named variable in the
+// environment of the call, or the empty string if it was
+// not set.
+func (call FakeExecCall) Getenv(name string) string {
+	for _, kv := range call.Env {
+		if strings.HasPrefix(kv, name+"=") {
+			return kv[len(name)+1:]
+		}
+	}
+	return ""
+}
+
+// fakeExecConfig holds the configuration written alongside
+// a fake executable.
+type fakeExecConfig struct {
+	// Responses holds the response to each successive run.
+	Responses []FakeExecResponse `json:"responses"`
+
+	// CallsDir holds the directory that the executable
+	// records each of its runs in.
+	CallsDir string `json:"calls-dir"`
+
+	// Passthrough holds the path of the real executable
+	// to run instead of responding with Responses.
+	Passthrough string `json:"passthrough,omitempty"`
+
+	// RecordOutput determines whether the output of the
+	// real executable is recorded.
+	RecordOutput bool `json:"record-output,omitempty"`
+}
+
+// FakeExecutable represents an executable created by
+// PatchFakeExecutable or PatchExecutablePassthrough.
+type FakeExecutable struct {
+	// Name holds the name of the executable.
+	Name string
+
+	// Path holds the full path of the executable.
+	Path string
+
+	callsDir string
+}
+
+// PatchFakeExecutable creates an executable called execName in a new
+// test directory and adds that directory to the start of $PATH.
+//
+// The executable is a copy of the running test binary, which means
+// that it does not depend on any shell. When it is run, it responds
+// with the given responses in turn, repeating the last response once
+// they are exhausted (or responding with no output and a zero exit
+// code if there are none). Every run is recorded and can be retrieved
+// with the Calls method.
+//
+// The test binary must call RunExecHelperProcess from TestMain,
+// which recognises when the binary has been run as a fake
+// executable and takes over before any tests are run:
+//
+//	func TestMain(m *testing.M) {
+//		testing.RunExecHelperProcess()
+//		os.Exit(m.Run())
+//	}
+func PatchFakeExecutable(c *gc.C, patcher EnvironmentPatcher, execName string, responses ...FakeExecResponse) *FakeExecutable {
+	dir := c.MkDir()
+	patcher.PatchEnvironment("PATH", joinPathLists(dir, os.Getenv("PATH")))
+	return createFakeExecutable(c, dir, execName, fakeExecConfig{
+		Responses: responses,
+	})
+}
+
+// PatchExecutablePassthrough creates an executable called execName in
+// a new test directory, ahead of the real executable of that name in
+// $PATH, which records each run as PatchFakeExecutable does and then
+// runs the real executable with the same arguments, environment and
+// standard input. The exit code and duration of the real executable
+// are also recorded. SIGINT, SIGTERM, SIGHUP and SIGQUIT are forwarded
+// to the real executable, so a run stopped by one of them is recorded
+// as finished, with an exit code of -1 if the real executable is
+// terminated by it.
+//
+// The real executable is found when PatchExecutablePassthrough is
+// called; it is an error if there is none.
+func PatchExecutablePassthrough(c *gc.C, patcher EnvironmentPatcher, execName string) *FakeExecutable {
+	return patchExecutablePassthrough(c, patcher, execName, false)
+}
+
+// PatchExecutablePassthroughWithOutput is like PatchExecutablePassthrough
+// but also records the standard output and standard error of the real
+// executable. Note that the real executable then writes its output to
+// pipes rather than directly to the output of the recording executable,
+// which may change its behaviour if, for example, it checks whether it
+// is writing to a terminal.
+func PatchExecutablePassthroughWithOutput(c *gc.C, patcher EnvironmentPatcher, execName string) *FakeExecutable {
+	return patchExecutablePassthrough(c, patcher, execName, true)
+}
+
+func patchExecutablePassthrough(c *gc.C, patcher EnvironmentPatcher, execName string, recordOutput bool) *FakeExecutable {
+	realPath, err := exec.LookPath(execName)
+	c.Assert(err, jc.ErrorIsNil)
+	realPath, err = filepath.Abs(realPath)
+	c.Assert(err, jc.ErrorIsNil)
+	dir := c.MkDir()
+	patcher.PatchEnvironment("PATH", joinPathLists(dir, os.Getenv("PATH")))
+	return createFakeExecutable(c, dir, execName, fakeExecConfig{
+		Passthrough:  realPath,
+		RecordOutput: recordOutput,
+	})
+}
+
+// createFakeExecutable creates a fake executable in the given
+// directory with the given configuration. The CallsDir field
+// of the configuration is filled in.
+func createFakeExecutable(c *gc.C, dir, execName string, cfg fakeExecConfig) *FakeExecutable {
+	self, err := os.Executable()
+	c.Assert(err, jc.ErrorIsNil)
+
+	path := filepath.Join(dir, execName)
+	if runtime.GOOS == "windows" {
+		path += ".exe"
+	}
+	err = linkOrCopyFile(self, path)
+	c.Assert(err, jc.ErrorIsNil)
+
+	cfg.CallsDir = filepath.Join(dir, execName+".calls")
+	err = os.Mkdir(cfg.CallsDir, 0755)
+	c.Assert(err, jc.ErrorIsNil)
+	data, err := json.Marshal(cfg)
+	c.Assert(err, jc.ErrorIsNil)
+	err = os.WriteFile(fakeExecConfigPath(path), data, 0644)
+	c.Assert(err, jc.ErrorIsNil)
+
+	return &FakeExecutable{
+		Name:     execName,
+		Path:     path,
+		callsDir: cfg.CallsDir,
+	}
+}
+
+// Calls returns the runs of the executable that have finished,
+// in the order they were started.
+func (f *FakeExecutable) Calls(c *gc.C) []FakeExecCall {
+	var calls []FakeExecCall
+	for _, call := range f.Runs(c) {
+		if call.Finished {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// Runs returns all the runs of the executable that have started,
+// including those that are still running or were killed, in the
+// order they were started.
+func (f *FakeExecutable) Runs(c *gc.C) []FakeExecCall {
+	names, err := filepath.Glob(filepath.Join(f.callsDir, "*.json"))
+	c.Assert(err, jc.ErrorIsNil)
+	sort.Strings(names)
+	var calls []FakeExecCall
+	for _, name := range names {
+		data, err := os.ReadFile(name)
+		c.Assert(err, jc.ErrorIsNil)
+		call, ok := readFakeExecEvents(c, data)
+		if ok {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// readFakeExecEvents returns the call recorded by the given
+// events. It returns false if the run has not yet recorded
+// that it has started.
+func readFakeExecEvents(c *gc.C, data []byte) (FakeExecCall, bool) {
+	var call FakeExecCall
+	started := false
+	for _, line := range bytes.SplitAfter(data, []byte("\n")) {
+		if !bytes.HasSuffix(line, []byte("\n")) {
+			// The line is still being written.
+			break
+		}
+		var event fakeExecEvent
+		err := json.Unmarshal(line, &event)
+		c.Assert(err, jc.ErrorIsNil)
+		switch {
+		case event.Started != nil:
+			call, started = *event.Started, true
+		case event.Signal != nil:
+			call.Signals = append(call.Signals, *event.Signal)
+		case event.Finished != nil:
+			signals := call.Signals
+			call = *event.Finished
+			call.Signals = signals
+			call.Finished = true
+		}
+	}
+	return call, started
+}
+
+// WaitRuns waits until at least n runs of the executable have
+// started, and returns all the runs as for Runs. Once a run has
+// started, any signals it ignores or traps are being handled.
+// It fails the test if the runs have not started within LongWait.
+func (f *FakeExecutable) WaitRuns(c *gc.C, n int) []FakeExecCall {
+	timeout := time.After(LongWait)
+	for {
+		if runs := f.Runs(c); len(runs) >= n {
+			return runs
+		}
+		select {
+		case <-time.After(10 * time.Millisecond):
+		case <-timeout:
+			c.Fatalf("timed out waiting for %d runs of %s to start", n, f.Name)
+		}
+	}
+}
+
+// Release allows all runs of the executable that are waiting
+// for release, and any later runs, to exit.
+func (f *FakeExecutable) Release(c *gc.C) {
+	err := os.WriteFile(fakeExecReleasePath(f.callsDir), nil, 0644)
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+// Stub returns a Stub holding a call for each completed run of
+// the executable, so that the runs can be checked with the methods
+// of Stub. Each call has the name of the executable as its FuncName
+// and the arguments of the run as its Args.
+func (f *FakeExecutable) Stub(c *gc.C) *Stub {
+	stub := &Stub{}
+	for _, call := range f.Calls(c) {
+		args := make([]interface{}, len(call.Args))
+		for i, arg := range call.Args {
+			args[i] = arg
+		}
+		stub.AddCall(f.Name, args...)
+	}
+	return stub
+}
+
+// CheckArgs checks that the executable has been run with the
+// given arguments, in order.
+func (f *FakeExecutable) CheckArgs(c *gc.C, args ...[]string) {
+	calls := f.Calls(c)
+	obtained := make([][]string, len(calls))
+	for i, call := range calls {
+		obtained[i] = call.Args
+	}
+	if len(args) == 0 {
+		args = [][]string{}
+	}
+	c.Check(obtained, jc.DeepEquals, args)
+}
+
+// runFakeExecutableIfConfigured acts as the fake executable
+// and exits if the current process is a fake executable created
+// by PatchFakeExecutable or PatchExecutablePassthrough. Otherwise
+// it does nothing.
+func runFakeExecutableIfConfigured() {
+	self, err := os.Executable()
+	if err != nil {
+		return
+	}
+	data, err := os.ReadFile(fakeExecConfigPath(self))
+	if err != nil {
+		return
+	}
+	os.Exit(runFakeExecutable(data))
+}
+
+// fakeExecConfigPath returns the path of the configuration
+// file of the fake executable at the given path.
+func fakeExecConfigPath(path string) string {
+	return strings.TrimSuffix(path, ".exe") + ".fakeexec"
+}
+
+// fakeExecReleasePath returns the path of the file which
+// releases the runs of a fake executable, given the
+// directory that records its runs.
+func fakeExecReleasePath(callsDir string) string {
+	return filepath.Join(callsDir, "release")
+}
+
+// callRecorder records the events of a single run
+// of a fake executable in its call file.
+type callRecorder struct {
+	// mu guards the fields below it.
+	mu       sync.Mutex
+	file     *os.File
+	finished bool
+}
+
+func (r *callRecorder) record(event fakeExecEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.finished {
+		return nil
+	}
+	r.finished = event.Finished != nil
+	_, err = r.file.Write(append(data, '\n'))
+	return err
+}
+
+// runFakeExecutable acts as a fake executable with the given
+// configuration, and returns its exit code.
+func runFakeExecutable(data []byte) int {
+	var cfg fakeExecConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "fake executable: cannot parse configuration: %v\n", err)
+		return 127
+	}
+	callFile, index, err := createCallFile(cfg.CallsDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fake executable: %v\n", err)
+		return 127
+	}
+	defer callFile.Close()
+	rec := &callRecorder{file: callFile}
+
+	dir, _ := os.Getwd()
+	call := FakeExecCall{
+		Args:    os.Args[1:],
+		Env:     os.Environ(),
+		Dir:     dir,
+		Started: time.Now(),
+	}
+	if cfg.Passthrough != "" {
+		err = runPassthrough(cfg, rec, &call)
+	} else {
+		err = respond(cfg, index, rec, &call)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fake executable: %v\n", err)
+		return 127
+	}
+	if err := finishCall(rec, call); err != nil {
+		fmt.Fprintf(os.Stderr, "fake executable: cannot record call: %v\n", err)
+		return 127
+	}
+	if call.ExitCode < 0 {
+		return 1
+	}
+	return call.ExitCode
+}
+
+// startCall records that the run has started.
+func startCall(rec *callRecorder, call FakeExecCall) error {
+	if err := rec.record(fakeExecEvent{Started: &call}); err != nil {
+		return fmt.Errorf("cannot record call: %v", err)
+	}
+	return nil
+}
+
+// finishCall records that the run has finished.
+func finishCall(rec *callRecorder, call FakeExecCall) error {
+	call.Duration = time.Since(call.Started)
+	call.Finished = true
+	return rec.record(fakeExecEvent{Finished: &call})
+}
+
+// respond responds to the run with the given index as
+// configured, and fills in the details of the call.
+func respond(cfg fakeExecConfig, index int, rec *callRecorder, call *FakeExecCall) error {
+	var resp FakeExecResponse
+	if len(cfg.Responses) > 0 {
+		resp = cfg.Responses[len(cfg.Responses)-1]
+		if index < len(cfg.Responses) {
+			resp = cfg.Responses[index]
+		}
+	}
+	// Handle signals before recording the start of the run,
+	// so that a test that has seen the run start can safely
+	// send them.
+	handleSignals(resp, rec, *call)
+	if err := startCall(rec, *call); err != nil {
+		return err
+	}
+	if resp.ReadStdin {
+		stdin, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("cannot read stdin: %v", err)
+		}
+		call.Stdin = string(stdin)
+	}
+	time.Sleep(resp.Delay)
+	writeSlowly(os.Stdout, resp.Stdout, resp.LineDelay)
+	writeSlowly(os.Stderr, resp.Stderr, resp.LineDelay)
+	if resp.WaitForRelease {
+		releasePath := fakeExecReleasePath(cfg.CallsDir)
+		for {
+			if _, err := os.Stat(releasePath); err == nil {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	call.ExitCode = resp.ExitCode
+	return nil
+}
+
+// handleSignals starts handling the signals that the response
+// ignores or traps. The given call is recorded as finished if
+// the executable exits because of a trapped signal.
+func handleSignals(resp FakeExecResponse, rec *callRecorder, call FakeExecCall) {
+	if len(resp.IgnoreSignals) == 0 && len(resp.TrapSignals) == 0 {
+		return
+	}
+	trapped := make(map[syscall.Signal]bool)
+	var sigs []os.Signal
+	for _, sig := range resp.IgnoreSignals {
+		sigs = append(sigs, sig)
+	}
+	for _, sig := range resp.TrapSignals {
+		sigs = append(sigs, sig)
+		trapped[sig] = true
+	}
+	received := make(chan os.Signal, len(sigs))
+	signal.Notify(received, sigs...)
+	go func() {
+		for s := range received {
+			sig, _ := s.(syscall.Signal)
+			rec.record(fakeExecEvent{Signal: &FakeExecSignal{
+				Signal: sig,
+				Time:   time.Now(),
+			}})
+			if trapped[sig] {
+				call.ExitCode = 128 + int(sig)
+				finishCall(rec, call)
+				os.Exit(call.ExitCode)
+			}
+		}
+	}()
+}
+
+// writeSlowly writes the given text to w, waiting
+// for the given delay after each line.
+func writeSlowly(w io.Writer, text string, delay time.Duration) {
+	if delay == 0 {
+		fmt.Fprint(w, text)
+		return
+	}
+	for _, line := range strings.SplitAfter(text, "\n") {
+		if line != "" {
+			fmt.Fprint(w, line)
+			time.Sleep(delay)
+		}
+	}
+}
+
+// passthroughSignals holds the signals that a passed through
+// executable forwards to the real executable.
+var passthroughSignals = []os.Signal{os.Interrupt, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT}
+
+// runPassthrough runs the real executable and fills in
+// the details of the call.
+//
+// Signals in passthroughSignals are forwarded to the real
+// executable rather than killing the recording executable,
+// so that the real executable does not outlive it and the
+// run is still recorded as finished. SIGKILL cannot be
+// forwarded, so killing the recording executable with it
+// leaves the real executable running.
+func runPassthrough(cfg fakeExecConfig, rec *callRecorder, call *FakeExecCall) error {
+	// Handle signals before recording the start of the run,
+	// so that a test that has seen the run start can safely
+	// send them.
+	signals := make(chan os.Signal, len(passthroughSignals))
+	signal.Notify(signals, passthroughSignals...)
+	defer signal.Stop(signals)
+	if err := startCall(rec, *call); err != nil {
+		return err
+	}
+	cmd := exec.Command(cfg.Passthrough, call.Args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	var stdout, stderr bytes.Buffer
+	if cfg.RecordOutput {
+		cmd.Stdout = io.MultiWriter(os.Stdout, &stdout)
+		cmd.Stderr = io.MultiWriter(os.Stderr, &stderr)
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case sig := <-signals:
+				cmd.Process.Signal(sig)
+			case <-done:
+				return
+			}
+		}
+	}()
+	err := cmd.Wait()
+	if _, ok := err.(*exec.ExitError); !ok && err != nil {
+		return err
+	}
+	call.ExitCode = cmd.ProcessState.ExitCode()
+	call.Stdout = stdout.String()
+	call.Stderr = stderr.String()
+	return nil
+}
+
+// createCallFile creates the file that records a run of a fake
+// executable, and returns it along with the index of the run.
+// Runs are numbered in the order that they create their files,
+// which is safe even when runs are concurrent.
+func createCallFile(dir string) (*os.File, int, error) {
+	for index := 0; ; index++ {
+		f, err := os.OpenFile(filepath.Join(dir, fmt.Sprintf("%06d.json", index)), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			return f, index, nil
+		}
+		if !os.IsExist(err) {
+			return nil, 0, fmt.Errorf("cannot record call: %v", err)
+		}
+	}
+}
+
+// linkOrCopyFile makes the file at src available at dst, by
+// making a hard link if possible and copying it otherwise.
+func linkOrCopyFile(src, dst string) error {
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0755)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,339 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package testing_test
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+)
+
+type fakeExecSuite struct {
+	testing.CleanupSuite
+}
+
+var _ = gc.Suite(&fakeExecSuite{})
+
+func (s *fakeExecSuite) TestResponses(c *gc.C) {
+	fake := testing.PatchFakeExecutable(c, s, "fake-tool", testing.FakeExecResponse{
+		Stdout: "first line\nsecond line\n",
+		Stderr: "a warning\n",
+	}, testing.FakeExecResponse{
+		Stdout:   "failing\n",
+		ExitCode: 3,
+	})
+	path, err := exec.LookPath("fake-tool")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(path, gc.Equals, fake.Path)
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("fake-tool", "a", "b c")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(stdout.String(), gc.Equals, "first line\nsecond line\n")
+	c.Check(stderr.String(), gc.Equals, "a warning\n")
+
+	// The last response is repeated once they run out.
+	for i := 0; i < 2; i++ {
+		out, err := exec.Command("fake-tool", "again").Output()
+		c.Check(err, gc.ErrorMatches, "exit status 3")
+		c.Check(string(out), gc.Equals, "failing\n")
+	}
+	fake.CheckArgs(c, []string{"a", "b c"}, []string{"again"}, []string{"again"})
+}
+
+func (s *fakeExecSuite) TestRecordsCall(c *gc.C) {
+	fake := testing.PatchFakeExecutable(c, s, "fake-tool", testing.FakeExecResponse{
+		ReadStdin: true,
+	})
+	dir := c.MkDir()
+	cmd := exec.Command("fake-tool", "--flag")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "FAKE_EXEC_TEST=value")
+	cmd.Stdin = strings.NewReader("some input")
+	err := cmd.Run()
+	c.Assert(err, jc.ErrorIsNil)
+
+	calls := fake.Calls(c)
+	c.Assert(calls, gc.HasLen, 1)
+	c.Check(calls[0].Args, jc.DeepEquals, []string{"--flag"})
+	c.Check(calls[0].Dir, jc.SamePath, dir)
+	c.Check(calls[0].Stdin, gc.Equals, "some input")
+	c.Check(calls[0].Getenv("FAKE_EXEC_TEST"), gc.Equals, "value")
+	c.Check(calls[0].Getenv("FAKE_EXEC_UNSET"), gc.Equals, "")
+}
+
+func (s *fakeExecSuite) TestDelay(c *gc.C) {
+	testing.PatchFakeExecutable(c, s, "fake-tool", testing.FakeExecResponse{
+		Delay: 200 * time.Millisecond,
+	})
+	start := time.Now()
+	err := exec.Command("fake-tool").Run()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(time.Since(start) >= 200*time.Millisecond, jc.IsTrue)
+}
+
+func (s *fakeExecSuite) TestNoCalls(c *gc.C) {
+	fake := testing.PatchFakeExecutable(c, s, "fake-tool")
+	c.Check(fake.Calls(c), gc.HasLen, 0)
+	fake.CheckArgs(c)
+	err := exec.Command("fake-tool").Run()
+	c.Assert(err, jc.ErrorIsNil)
+	fake.CheckArgs(c, []string{})
+}
+
+func (s *fakeExecSuite) TestWaitForRelease(c *gc.C) {
+	fake := testing.PatchFakeExecutable(c, s, "fake-tool", testing.FakeExecResponse{
+		Stdout:         "waiting\n",
+		WaitForRelease: true,
+	})
+	cmd := exec.Command("fake-tool")
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	err := cmd.Start()
+	c.Assert(err, jc.ErrorIsNil)
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	runs := fake.WaitRuns(c, 1)
+	c.Check(runs[0].Finished, jc.IsFalse)
+	c.Check(fake.Calls(c), gc.HasLen, 0)
+	select {
+	case err := <-done:
+		c.Fatalf("executable exited before release: %v", err)
+	case <-time.After(testing.ShortWait):
+	}
+
+	fake.Release(c)
+	select {
+	case err := <-done:
+		c.Assert(err, jc.ErrorIsNil)
+	case <-time.After(testing.LongWait):
+		c.Fatalf("executable did not exit after release")
+	}
+	c.Check(stdout.String(), gc.Equals, "waiting\n")
+	calls := fake.Calls(c)
+	c.Assert(calls, gc.HasLen, 1)
+	c.Check(calls[0].Finished, jc.IsTrue)
+	c.Check(calls[0].Started.IsZero(), jc.IsFalse)
+}
+
+func (s *fakeExecSuite) TestLineDelay(c *gc.C) {
+	testing.PatchFakeExecutable(c, s, "fake-tool", testing.FakeExecResponse{
+		Stdout:    "one\ntwo\nthree\n",
+		LineDelay: 50 * time.Millisecond,
+	})
+	cmd := exec.Command("fake-tool")
+	stdout, err := cmd.StdoutPipe()
+	c.Assert(err, jc.ErrorIsNil)
+	err = cmd.Start()
+	c.Assert(err, jc.ErrorIsNil)
+	defer cmd.Wait()
+
+	start := time.Now()
+	r := bufio.NewReader(stdout)
+	var lines []string
+	var times []time.Duration
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			break
+		}
+		lines = append(lines, line)
+		times = append(times, time.Since(start))
+	}
+	c.Check(lines, jc.DeepEquals, []string{"one\n", "two\n", "three\n"})
+	c.Assert(times, gc.HasLen, 3)
+	c.Check(times[2]-times[0] >= 100*time.Millisecond, jc.IsTrue)
+}
+
+func (s *fakeExecSuite) TestTermThenKill(c *gc.C) {
+	if runtime.GOOS == "windows" {
+		c.Skip("signals cannot be sent on windows")
+	}
+	fake := testing.PatchFakeExecutable(c, s, "fake-tool", testing.FakeExecResponse{
+		IgnoreSignals:  []syscall.Signal{syscall.SIGTERM},
+		WaitForRelease: true,
+	})
+	cmd := exec.Command("fake-tool")
+	err := cmd.Start()
+	c.Assert(err, jc.ErrorIsNil)
+	fake.WaitRuns(c, 1)
+
+	// Act as a supervisor that asks nicely first.
+	err = cmd.Process.Signal(syscall.SIGTERM)
+	c.Assert(err, jc.ErrorIsNil)
+	timeout := time.After(testing.LongWait)
+	for len(fake.Runs(c)[0].Signals) == 0 {
+		select {
+		case <-time.After(10 * time.Millisecond):
+		case <-timeout:
+			c.Fatalf("signal not recorded")
+		}
+	}
+	err = cmd.Process.Kill()
+	c.Assert(err, jc.ErrorIsNil)
+	err = cmd.Wait()
+	c.Assert(err, gc.ErrorMatches, "signal: killed")
+
+	runs := fake.Runs(c)
+	c.Assert(runs, gc.HasLen, 1)
+	c.Assert(runs[0].Signals, gc.HasLen, 1)
+	c.Check(runs[0].Signals[0].Signal, gc.Equals, syscall.SIGTERM)
+	c.Check(runs[0].Signals[0].Time.Before(runs[0].Started), jc.IsFalse)
+	c.Check(runs[0].Finished, jc.IsFalse)
+	c.Check(fake.Calls(c), gc.HasLen, 0)
+}
+
+func (s *fakeExecSuite) TestTrapSignals(c *gc.C) {
+	if runtime.GOOS == "windows" {
+		c.Skip("signals cannot be sent on windows")
+	}
+	fake := testing.PatchFakeExecutable(c, s, "fake-tool", testing.FakeExecResponse{
+		TrapSignals:    []syscall.Signal{syscall.SIGTERM},
+		WaitForRelease: true,
+	})
+	cmd := exec.Command("fake-tool", "arg")
+	err := cmd.Start()
+	c.Assert(err, jc.ErrorIsNil)
+	fake.WaitRuns(c, 1)
+
+	err = cmd.Process.Signal(syscall.SIGTERM)
+	c.Assert(err, jc.ErrorIsNil)
+	err = cmd.Wait()
+	c.Assert(err, gc.ErrorMatches, "exit status 143")
+
+	calls := fake.Calls(c)
+	c.Assert(calls, gc.HasLen, 1)
+	c.Check(calls[0].Args, jc.DeepEquals, []string{"arg"})
+	c.Check(calls[0].ExitCode, gc.Equals, 143)
+	c.Assert(calls[0].Signals, gc.HasLen, 1)
+	c.Check(calls[0].Signals[0].Signal, gc.Equals, syscall.SIGTERM)
+}
+
+func (s *fakeExecSuite) TestPassthrough(c *gc.C) {
+	if runtime.GOOS == "windows" {
+		c.Skip("test relies on sh")
+	}
+	fake := testing.PatchExecutablePassthrough(c, s, "sh")
+	path, err := exec.LookPath("sh")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(path, gc.Equals, fake.Path)
+
+	cmd := exec.Command("sh", "-c", "read line; echo got $line; echo oops >&2; exit 3")
+	cmd.Stdin = strings.NewReader("input\n")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	c.Assert(err, gc.ErrorMatches, "exit status 3")
+	c.Check(stdout.String(), gc.Equals, "got input\n")
+	c.Check(stderr.String(), gc.Equals, "oops\n")
+
+	calls := fake.Calls(c)
+	c.Assert(calls, gc.HasLen, 1)
+	c.Check(calls[0].Args, jc.DeepEquals, []string{"-c", "read line; echo got $line; echo oops >&2; exit 3"})
+	c.Check(calls[0].ExitCode, gc.Equals, 3)
+	c.Check(calls[0].Duration > 0, jc.IsTrue)
+	c.Check(calls[0].Stdout, gc.Equals, "")
+
+	fake.Stub(c).CheckCall(c, 0, "sh", "-c", "read line; echo got $line; echo oops >&2; exit 3")
+}
+
+func (s *fakeExecSuite) TestPassthroughWithOutput(c *gc.C) {
+	if runtime.GOOS == "windows" {
+		c.Skip("test relies on sh")
+	}
+	fake := testing.PatchExecutablePassthroughWithOutput(c, s, "sh")
+	out, err := exec.Command("sh", "-c", "echo hello; echo world >&2").Output()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(out), gc.Equals, "hello\n")
+	err = exec.Command("sh", "-c", "exit 0").Run()
+	c.Assert(err, jc.ErrorIsNil)
+
+	calls := fake.Calls(c)
+	c.Assert(calls, gc.HasLen, 2)
+	c.Check(calls[0].Stdout, gc.Equals, "hello\n")
+	c.Check(calls[0].Stderr, gc.Equals, "world\n")
+	fake.Stub(c).CheckCalls(c, []testing.StubCall{{
+		FuncName: "sh",
+		Args:     []interface{}{"-c", "echo hello; echo world >&2"},
+	}, {
+		FuncName: "sh",
+		Args:     []interface{}{"-c", "exit 0"},
+	}})
+}
+
+func (s *fakeExecSuite) TestPassthroughForwardsSignals(c *gc.C) {
+	if runtime.GOOS == "windows" {
+		c.Skip("test relies on sh and signals")
+	}
+	fake := testing.PatchExecutablePassthrough(c, s, "sh")
+	pidFile := filepath.Join(c.MkDir(), "pid")
+	cmd := exec.Command("sh", "-c", `echo $$ > "$0"; exec sleep 30`, pidFile)
+	err := cmd.Start()
+	c.Assert(err, jc.ErrorIsNil)
+	defer cmd.Process.Kill()
+	fake.WaitRuns(c, 1)
+
+	// Wait for the real executable to start.
+	timeout := time.After(testing.LongWait)
+	var data []byte
+	for !bytes.HasSuffix(data, []byte("\n")) {
+		select {
+		case <-time.After(10 * time.Millisecond):
+		case <-timeout:
+			c.Fatalf("timed out waiting for sh to start")
+		}
+		data, _ = os.ReadFile(pidFile)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	c.Assert(err, jc.ErrorIsNil)
+
+	err = cmd.Process.Signal(syscall.SIGTERM)
+	c.Assert(err, jc.ErrorIsNil)
+	err = cmd.Wait()
+	c.Assert(err, gc.ErrorMatches, "exit status 1")
+
+	calls := fake.Calls(c)
+	c.Assert(calls, gc.HasLen, 1)
+	c.Check(calls[0].ExitCode, gc.Equals, -1)
+	c.Check(calls[0].Duration < 30*time.Second, jc.IsTrue)
+
+	// The real executable has been waited for, so it has gone.
+	proc, err := os.FindProcess(pid)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(proc.Signal(syscall.Signal(0)), gc.NotNil)
+}
+
+func (s *fakeExecSuite) TestPassthroughNotFound(c *gc.C) {
+	var output bytes.Buffer
+	result := gc.Run(&passthroughNotFoundSuite{}, &gc.RunConf{Output: &output})
+	c.Assert(result.Failed, gc.Equals, 1)
+	c.Assert(output.String(), gc.Matches, `(?s).*executable file not found in \$PATH.*`)
+}
+
+type passthroughNotFoundSuite struct {
+	testing.CleanupSuite
+}
+
+func (s *passthroughNotFoundSuite) TestNotFound(c *gc.C) {
+	testing.PatchExecutablePassthrough(c, s, "no-such-executable-anywhere")
+}
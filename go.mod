@@ -8,6 +8,7 @@ require (
 	github.com/juju/errors v1.0.0
 	github.com/juju/loggo/v2 v2.0.0
 	github.com/juju/utils/v4 v4.0.0
+	github.com/rogpeppe/go-internal v1.9.0
 	gopkg.in/check.v1 v1.0.0-20201130134442-10cb98267c6c
 	gopkg.in/yaml.v2 v2.4.0
 )
@@ -16,7 +17,6 @@ require (
 	github.com/juju/clock v1.0.3 // indirect
 	github.com/kr/pretty v0.3.1 // indirect
 	github.com/kr/text v0.2.0 // indirect
-	github.com/rogpeppe/go-internal v1.9.0 // indirect
 	golang.org/x/crypto v0.19.0 // indirect
 	golang.org/x/net v0.21.0 // indirect
 )
@@ -10,6 +10,8 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"regexp"
+	"sync"
 	"time"
 
 	gc "gopkg.in/check.v1"
@@ -28,6 +30,7 @@ func (s *HTTPSuite) SetUpTest(c *gc.C) {}
 
 func (s *HTTPSuite) TearDownTest(c *gc.C) {
 	Server.Flush()
+	Server.ClearRoutes()
 }
 
 func (s *HTTPSuite) URL(path string) string {
@@ -40,6 +43,14 @@ type HTTPServer struct {
 	started  bool
 	request  chan *http.Request
 	response chan ResponseFunc
+
+	mu sync.Mutex
+	// routing holds whether Start has finished, after
+	// which requests are answered by any routes.
+	routing   bool
+	routes    []*route
+	routed    []*http.Request
+	unmatched []*http.Request
 }
 
 func NewHTTPServer(timeout time.Duration) *HTTPServer {
@@ -54,6 +65,105 @@ type Response struct {
 
 type ResponseFunc func(path string) Response
 
+// Route describes requests that an HTTPServer responds to in the
+// same way each time they are made, and the response to make.
+// A request matches the route only if it matches all the fields
+// that are set.
+type Route struct {
+	// Method holds the method of the request, such as "GET".
+	Method string
+
+	// Path holds a regular expression that must
+	// match the whole path of the request.
+	Path string
+
+	// Query holds query parameters that the request must
+	// have, with the values that they must have. A parameter
+	// that is given more than once matches if any of its
+	// values does.
+	Query map[string]string
+
+	// Headers holds headers that the request must
+	// have, with the values that they must have. A header
+	// that is given more than once matches if any of its
+	// values does.
+	Headers map[string]string
+
+	// Body, if not nil, is called with the body of the
+	// request and reports whether the request matches.
+	Body func(body []byte) bool
+
+	// Response holds the response to make
+	// to requests that match the route.
+	Response Response
+
+	// Respond, if not nil, is called to build the response to
+	// a request that matches the route, instead of using Response.
+	// The body of the request can be read again after the route
+	// has been matched.
+	Respond func(req *http.Request) Response
+}
+
+// String returns a description of the requests matched by the route.
+func (r Route) String() string {
+	method, path := r.Method, r.Path
+	if method == "" {
+		method = "*"
+	}
+	if path == "" {
+		path = ".*"
+	}
+	desc := method + " " + path
+	if len(r.Query) > 0 {
+		desc += fmt.Sprintf(" query %v", r.Query)
+	}
+	if len(r.Headers) > 0 {
+		desc += fmt.Sprintf(" headers %v", r.Headers)
+	}
+	if r.Body != nil {
+		desc += " body matching predicate"
+	}
+	return desc
+}
+
+type route struct {
+	Route
+	path *regexp.Regexp
+}
+
+func (r *route) match(req *http.Request, data []byte) bool {
+	if r.Method != "" && r.Method != req.Method {
+		return false
+	}
+	if r.path != nil && !r.path.MatchString(req.URL.Path) {
+		return false
+	}
+	query := req.URL.Query()
+	for k, v := range r.Query {
+		if !containsValue(query[k], v) {
+			return false
+		}
+	}
+	for k, v := range r.Headers {
+		if !containsValue(req.Header.Values(k), v) {
+			return false
+		}
+	}
+	if r.Body != nil && !r.Body(data) {
+		return false
+	}
+	return true
+}
+
+func containsValue(vs []string, v string) bool {
+	for _, x := range vs {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
 func (s *HTTPServer) Start() {
 	if s.started {
 		return
@@ -80,6 +190,12 @@ func (s *HTTPServer) Start() {
 		time.Sleep(1e8)
 	}
 	s.WaitRequest() // Consume dummy request.
+
+	// Routes may have been added already, so only start using
+	// them once the dummy request has had its queued response.
+	s.mu.Lock()
+	s.routing = true
+	s.mu.Unlock()
 }
 
 // Flush discards all pending requests and responses.
@@ -109,6 +225,10 @@ func (s *HTTPServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		panic(err)
 	}
 	req.Body = ioutil.NopCloser(bytes.NewBuffer(data))
+	if resp, ok := s.routeResponse(req, data); ok {
+		writeResponse(w, resp)
+		return
+	}
 	s.request <- req
 	var resp Response
 	select {
@@ -119,6 +239,10 @@ func (s *HTTPServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		fmt.Fprintf(os.Stderr, msg)
 		resp = Response{500, nil, []byte(msg)}
 	}
+	writeResponse(w, resp)
+}
+
+func writeResponse(w http.ResponseWriter, resp Response) {
 	if resp.Headers != nil {
 		h := w.Header()
 		for k, v := range resp.Headers {
@@ -131,6 +255,90 @@ func (s *HTTPServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	w.Write(resp.Body)
 }
 
+// routeResponse returns the response to the request from the first
+// route that matches it, and whether there is one. If there are routes
+// but none matches, the request is recorded as unmatched and a 404
+// response describing it is returned. If there are no routes, it
+// returns false and the request is answered by the queued responses.
+func (s *HTTPServer) routeResponse(req *http.Request, data []byte) (Response, bool) {
+	s.mu.Lock()
+	routes, routing := s.routes, s.routing
+	s.mu.Unlock()
+	if !routing || len(routes) == 0 {
+		return Response{}, false
+	}
+	for _, r := range routes {
+		if !r.match(req, data) {
+			continue
+		}
+		s.mu.Lock()
+		s.routed = append(s.routed, req)
+		s.mu.Unlock()
+		if r.Respond == nil {
+			return r.Response, true
+		}
+		req.Body = ioutil.NopCloser(bytes.NewBuffer(data))
+		resp := r.Respond(req)
+		req.Body = ioutil.NopCloser(bytes.NewBuffer(data))
+		return resp, true
+	}
+	s.mu.Lock()
+	s.unmatched = append(s.unmatched, req)
+	s.mu.Unlock()
+	msg := fmt.Sprintf("ERROR: No route matches request %s %s\nroutes:\n", req.Method, req.URL.RequestURI())
+	for _, r := range routes {
+		msg += "    " + r.String() + "\n"
+	}
+	fmt.Fprint(os.Stderr, msg)
+	return Response{Status: http.StatusNotFound, Body: []byte(msg)}, true
+}
+
+// AddRoute adds a route that the server uses to respond to all the
+// matching requests that it receives, until the routes are cleared.
+// Routes are tried in the order they were added, and are used before
+// any responses prepared with ResponseFunc and similar methods, which
+// are not used at all while there are any routes. Requests answered by
+// routes are not queued for WaitRequest; they are recorded instead,
+// and returned by RoutedRequests and UnmatchedRequests.
+// Routes may be added before the server is started, but are only
+// used once Start has returned.
+func (s *HTTPServer) AddRoute(r Route) {
+	rt := &route{Route: r}
+	if r.Path != "" {
+		rt.path = regexp.MustCompile("^(?:" + r.Path + ")$")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.routes = append(s.routes[:len(s.routes):len(s.routes)], rt)
+}
+
+// ClearRoutes removes all the routes that have been added, and
+// forgets the requests that were answered by the routes.
+func (s *HTTPServer) ClearRoutes() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.routes = nil
+	s.routed = nil
+	s.unmatched = nil
+}
+
+// RoutedRequests returns the requests that matched a route,
+// in the order they were received.
+func (s *HTTPServer) RoutedRequests() []*http.Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*http.Request(nil), s.routed...)
+}
+
+// UnmatchedRequests returns the requests that were received while
+// there were routes but did not match any of them. Such requests are
+// answered with a 404 response describing them.
+func (s *HTTPServer) UnmatchedRequests() []*http.Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*http.Request(nil), s.unmatched...)
+}
+
 // WaitRequests returns the next n requests made to the http server from
 // the queue. If not enough requests were previously made, it waits until
 // the timeout value for them to be made.
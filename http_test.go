@@ -0,0 +1,193 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package testing_test
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/juju/testing"
+	gc "gopkg.in/check.v1"
+)
+
+var _ = gc.Suite(&httpServerSuite{})
+
+type httpServerSuite struct {
+	server *testing.HTTPServer
+}
+
+func (s *httpServerSuite) SetUpSuite(c *gc.C) {
+	s.server = testing.NewHTTPServer(5 * time.Second)
+	s.server.Start()
+}
+
+func (s *httpServerSuite) TearDownTest(c *gc.C) {
+	s.server.Flush()
+	s.server.ClearRoutes()
+}
+
+func (s *httpServerSuite) TestRoutes(c *gc.C) {
+	s.server.AddRoute(testing.Route{
+		Method:   "GET",
+		Path:     "/x",
+		Response: testing.Response{Status: 200, Body: []byte("get x")},
+	})
+	s.server.AddRoute(testing.Route{
+		Method:   "POST",
+		Path:     "/x",
+		Query:    map[string]string{"y": "1"},
+		Response: testing.Response{Status: 201, Body: []byte("post x")},
+	})
+	s.server.AddRoute(testing.Route{
+		Path:     "/items/[0-9]+",
+		Headers:  map[string]string{"x-token": "secret"},
+		Response: testing.Response{Status: 200, Body: []byte("item")},
+	})
+	s.server.AddRoute(testing.Route{
+		Method: "PUT",
+		Body: func(body []byte) bool {
+			return bytes.HasPrefix(body, []byte("{"))
+		},
+		Respond: func(req *http.Request) testing.Response {
+			data, err := io.ReadAll(req.Body)
+			c.Check(err, gc.IsNil)
+			return testing.Response{
+				Status:  200,
+				Headers: map[string]string{"X-Path": req.URL.Path},
+				Body:    data,
+			}
+		},
+	})
+
+	// Routes are used for every matching request.
+	for i := 0; i < 2; i++ {
+		s.assertResponse(c, "GET", "/x", nil, nil, 200, "get x")
+		s.assertResponse(c, "POST", "/x?y=1", nil, nil, 201, "post x")
+	}
+	s.assertResponse(c, "GET", "/items/42", map[string]string{"X-Token": "secret"}, nil, 200, "item")
+	resp := s.assertResponse(c, "PUT", "/anything", nil, []byte(`{"a":1}`), 200, `{"a":1}`)
+	c.Assert(resp.Header.Get("X-Path"), gc.Equals, "/anything")
+	c.Assert(s.server.UnmatchedRequests(), gc.HasLen, 0)
+
+	// Requests answered by routes are recorded
+	// rather than queued for WaitRequest.
+	routed := s.server.RoutedRequests()
+	c.Assert(routed, gc.HasLen, 6)
+	c.Assert(routed[0].Method, gc.Equals, "GET")
+	c.Assert(routed[0].URL.Path, gc.Equals, "/x")
+	c.Assert(routed[5].Method, gc.Equals, "PUT")
+}
+
+func (s *httpServerSuite) TestRoutesManyRequests(c *gc.C) {
+	s.server.AddRoute(testing.Route{
+		Response: testing.Response{Status: 200, Body: []byte("ok")},
+	})
+	// More requests than the queue holds are all recorded.
+	for i := 0; i < 100; i++ {
+		s.assertResponse(c, "GET", "/x", nil, nil, 200, "ok")
+	}
+	c.Assert(s.server.RoutedRequests(), gc.HasLen, 100)
+	s.server.ClearRoutes()
+	c.Assert(s.server.RoutedRequests(), gc.HasLen, 0)
+}
+
+func (s *httpServerSuite) TestRouteMultipleValues(c *gc.C) {
+	s.server.AddRoute(testing.Route{
+		Query:    map[string]string{"y": "2"},
+		Headers:  map[string]string{"X-Tag": "b"},
+		Response: testing.Response{Status: 200, Body: []byte("ok")},
+	})
+	s.assertResponse(c, "GET", "/x?y=1&y=2", map[string]string{"X-Tag": "b"}, nil, 200, "ok")
+	c.Assert(s.server.UnmatchedRequests(), gc.HasLen, 0)
+
+	req, err := http.NewRequest("GET", s.server.URL+"/x?y=2", nil)
+	c.Assert(err, gc.IsNil)
+	req.Header.Add("X-Tag", "a")
+	req.Header.Add("X-Tag", "b")
+	resp, err := http.DefaultClient.Do(req)
+	c.Assert(err, gc.IsNil)
+	resp.Body.Close()
+	c.Assert(resp.StatusCode, gc.Equals, 200)
+}
+
+func (s *httpServerSuite) TestRouteBeforeStart(c *gc.C) {
+	server := testing.NewHTTPServer(5 * time.Second)
+	server.AddRoute(testing.Route{
+		Method:   "GET",
+		Path:     "/x",
+		Response: testing.Response{Status: 200, Body: []byte("x")},
+	})
+	started := make(chan struct{})
+	go func() {
+		defer close(started)
+		server.Start()
+	}()
+	select {
+	case <-started:
+	case <-time.After(testing.LongWait):
+		c.Fatalf("server did not start")
+	}
+	resp, err := http.Get(server.URL + "/x")
+	c.Assert(err, gc.IsNil)
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	c.Assert(err, gc.IsNil)
+	c.Assert(resp.StatusCode, gc.Equals, 200)
+	c.Assert(string(data), gc.Equals, "x")
+	c.Assert(server.UnmatchedRequests(), gc.HasLen, 0)
+}
+
+func (s *httpServerSuite) TestUnmatchedRequest(c *gc.C) {
+	stderr, err := os.Create(filepath.Join(c.MkDir(), "stderr"))
+	c.Assert(err, gc.IsNil)
+	defer stderr.Close()
+	restore := testing.PatchValue(&os.Stderr, stderr)
+	defer restore()
+
+	s.server.AddRoute(testing.Route{
+		Method:   "GET",
+		Path:     "/x",
+		Query:    map[string]string{"y": "1"},
+		Response: testing.Response{Status: 200},
+	})
+	msg := "ERROR: No route matches request POST /x\\?y=1\nroutes:\n    GET /x query map\\[y:1\\]\n"
+	s.assertResponse(c, "POST", "/x?y=1", nil, nil, 404, msg)
+	s.assertResponse(c, "GET", "/x", nil, nil, 404, "(?s).*")
+	s.assertResponse(c, "GET", "/x?y=2", nil, nil, 404, "(?s).*")
+
+	unmatched := s.server.UnmatchedRequests()
+	c.Assert(unmatched, gc.HasLen, 3)
+	c.Assert(unmatched[0].Method, gc.Equals, "POST")
+	c.Assert(unmatched[2].URL.RawQuery, gc.Equals, "y=2")
+	restore()
+	data, err := os.ReadFile(stderr.Name())
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Matches, "(?s)"+msg+".*")
+
+	// Clearing the routes reverts to the queued responses.
+	s.server.ClearRoutes()
+	c.Assert(s.server.UnmatchedRequests(), gc.HasLen, 0)
+	s.server.Response(202, nil, []byte("queued"))
+	s.assertResponse(c, "GET", "/x", nil, nil, 202, "queued")
+}
+
+func (s *httpServerSuite) assertResponse(c *gc.C, method, path string, headers map[string]string, body []byte, status int, bodyPattern string) *http.Response {
+	req, err := http.NewRequest(method, s.server.URL+path, bytes.NewReader(body))
+	c.Assert(err, gc.IsNil)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	c.Assert(err, gc.IsNil)
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	c.Assert(err, gc.IsNil)
+	c.Assert(resp.StatusCode, gc.Equals, status, gc.Commentf("body %q", data))
+	c.Assert(string(data), gc.Matches, bodyPattern)
+	return resp
+}
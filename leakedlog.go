@@ -0,0 +1,237 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package testing
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"sync"
+
+	"github.com/juju/loggo/v2"
+)
+
+// LeakedLogOutput receives a line for each log entry that is
+// written after the test that caused it has finished. Such
+// entries are not written to the log of any test.
+var LeakedLogOutput io.Writer = os.Stderr
+
+// LeakedLogEntry holds a log entry that was written after the
+// test that caused it had finished.
+type LeakedLogEntry struct {
+	loggo.Entry
+
+	// Test holds the name of the test that started the goroutine
+	// that wrote the entry. It is empty if the goroutine was not
+	// started directly by a test.
+	Test string
+
+	// After holds the name of the test that had most recently
+	// finished when the entry was written.
+	After string
+
+	// CreatedBy holds the function and location that started
+	// the goroutine that wrote the entry, if known.
+	CreatedBy string
+}
+
+// String returns a description of the entry, including where it
+// was logged from and which test it is attributed to.
+func (e LeakedLogEntry) String() string {
+	test := e.Test
+	if test == "" {
+		test = "unknown test (after " + e.After + ")"
+	}
+	s := fmt.Sprintf("leaked log entry from %s: %s %s %s:%d %s",
+		test, e.Level, e.Module, filepath.Base(e.Filename), e.Line, e.Message)
+	if e.CreatedBy != "" {
+		s += " [goroutine created by " + e.CreatedBy + "]"
+	}
+	return s
+}
+
+// leakedLog holds the state shared by all LoggingSuites to
+// track log entries written after their test has finished.
+//
+// A goroutine is attributed to a test only if it was started
+// by the goroutine running the test, as runtime.Stack reports
+// only the immediate creator of a goroutine. Entries written by
+// goroutines that those goroutines start in turn are reported as
+// leaked only when they are written to a detached writer.
+//
+// Finished tests are tracked only while goroutines that they
+// started are still running, as only those goroutines can write
+// entries attributed to them. While any are, every log entry
+// written by any test costs a call to runtime.Stack to find
+// the goroutine that wrote it.
+var leakedLog = struct {
+	// mu guards the fields below it.
+	mu sync.Mutex
+	// tests maps the ids of the goroutines running
+	// tests to the names of those tests.
+	tests map[uint64]string
+	// finished maps the ids of the goroutines that ran
+	// finished tests which left goroutines running to the
+	// names of those tests.
+	finished map[uint64]string
+	// entries holds all the leaked entries.
+	entries []LeakedLogEntry
+}{
+	tests:    make(map[uint64]string),
+	finished: make(map[uint64]string),
+}
+
+// LeakedLogEntries returns all the log entries that have been
+// written after the test that caused them had finished.
+func LeakedLogEntries() []LeakedLogEntry {
+	leakedLog.mu.Lock()
+	defer leakedLog.mu.Unlock()
+	entries := make([]LeakedLogEntry, len(leakedLog.entries))
+	copy(entries, leakedLog.entries)
+	return entries
+}
+
+// startTestGoroutine records that the named test is running,
+// and returns the id of the goroutine running the test, or 0 if
+// it cannot be determined. It must be called from SetUpTest,
+// which gocheck runs in a goroutine started by the test goroutine.
+func startTestGoroutine(testName string) uint64 {
+	stack := currentStack()
+	if !bytes.Contains(stack, []byte(").runFixture")) {
+		// We have not been called by gocheck, most likely
+		// because a test is calling SetUpTest itself, so
+		// our creator is not the test goroutine.
+		return 0
+	}
+	id, _ := goroutineCreator(stack)
+	if id == 0 {
+		return 0
+	}
+	leakedLog.mu.Lock()
+	defer leakedLog.mu.Unlock()
+	leakedLog.tests[id] = testName
+	return id
+}
+
+// finishTestGoroutine records that the test run by the
+// goroutine with the given id has finished. It also forgets
+// the finished tests, including this one, that have no
+// goroutines left running.
+func finishTestGoroutine(id uint64) {
+	if id == 0 {
+		return
+	}
+	running := runningCreators()
+	leakedLog.mu.Lock()
+	defer leakedLog.mu.Unlock()
+	if name, ok := leakedLog.tests[id]; ok {
+		delete(leakedLog.tests, id)
+		leakedLog.finished[id] = name
+	}
+	for id := range leakedLog.finished {
+		if !running[id] {
+			delete(leakedLog.finished, id)
+		}
+	}
+}
+
+// runningCreators returns the ids of the goroutines that started
+// the goroutines that are running, other than the calling one.
+func runningCreators() map[uint64]bool {
+	buf := make([]byte, 64*1024)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+	creators := make(map[uint64]bool)
+	// The trace of the calling goroutine comes first.
+	for _, stack := range bytes.Split(buf, []byte("\n\n"))[1:] {
+		if id, _ := goroutineCreator(stack); id != 0 {
+			creators[id] = true
+		}
+	}
+	return creators
+}
+
+// haveFinishedTests reports whether any tests have finished
+// that left goroutines running, which may still be writing
+// log entries.
+func haveFinishedTests() bool {
+	leakedLog.mu.Lock()
+	defer leakedLog.mu.Unlock()
+	return len(leakedLog.finished) > 0
+}
+
+// leakedBy reports the name of the finished test that started
+// the goroutine which produced the given stack, and the function
+// and location that started it.
+func leakedBy(stack []byte) (test string, createdBy string, leaked bool) {
+	id, createdBy := goroutineCreator(stack)
+	leakedLog.mu.Lock()
+	defer leakedLog.mu.Unlock()
+	if test, ok := leakedLog.finished[id]; ok {
+		return test, createdBy, true
+	}
+	return "", createdBy, false
+}
+
+// reportLeakedEntry records the given entry as leaked and
+// writes it to LeakedLogOutput.
+func reportLeakedEntry(entry LeakedLogEntry) {
+	leakedLog.mu.Lock()
+	leakedLog.entries = append(leakedLog.entries, entry)
+	leakedLog.mu.Unlock()
+	fmt.Fprintln(LeakedLogOutput, entry.String())
+}
+
+func currentStack() []byte {
+	buf := make([]byte, 8192)
+	for {
+		n := runtime.Stack(buf, false)
+		if n < len(buf) {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+// goroutineCreator parses the trace of a single goroutine as
+// produced by runtime.Stack and returns the id of the goroutine
+// that started it, along with the function and location that
+// started it.
+//
+// The trace ends with lines of the form:
+//
+//	created by example.com/pkg.f in goroutine 12
+//		/path/to/pkg/file.go:34 +0x1d
+func goroutineCreator(stack []byte) (id uint64, createdBy string) {
+	const createdByPrefix = "\ncreated by "
+	i := bytes.LastIndex(stack, []byte(createdByPrefix))
+	if i == -1 {
+		return 0, ""
+	}
+	lines := bytes.SplitN(stack[i+len(createdByPrefix):], []byte("\n"), 3)
+	creator := string(lines[0])
+	const inGoroutine = " in goroutine "
+	if j := bytes.LastIndex(lines[0], []byte(inGoroutine)); j != -1 {
+		creator = string(lines[0][:j])
+		id, _ = strconv.ParseUint(string(lines[0][j+len(inGoroutine):]), 10, 64)
+	}
+	if len(lines) > 1 {
+		location := bytes.TrimSpace(lines[1])
+		if k := bytes.LastIndex(location, []byte(" +0x")); k != -1 {
+			location = location[:k]
+		}
+		creator += " at " + string(location)
+	}
+	return id, creator
+}
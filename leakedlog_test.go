@@ -0,0 +1,163 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package testing
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/juju/loggo/v2"
+	gc "gopkg.in/check.v1"
+)
+
+type leakedLogSuite struct{}
+
+var _ = gc.Suite(&leakedLogSuite{})
+
+func (*leakedLogSuite) TestGoroutineCreator(c *gc.C) {
+	stack := []byte(`goroutine 42 [running]:
+example.com/pkg.f()
+	/src/pkg/f.go:10 +0x25
+created by example.com/pkg.(*S).TestFoo in goroutine 7
+	/src/pkg/foo_test.go:34 +0x1d
+`)
+	id, createdBy := goroutineCreator(stack)
+	c.Check(id, gc.Equals, uint64(7))
+	c.Check(createdBy, gc.Equals, "example.com/pkg.(*S).TestFoo at /src/pkg/foo_test.go:34")
+
+	id, createdBy = goroutineCreator([]byte("goroutine 1 [running]:\nmain.main()\n\t/src/main.go:5 +0x1\n"))
+	c.Check(id, gc.Equals, uint64(0))
+	c.Check(createdBy, gc.Equals, "")
+}
+
+func (*leakedLogSuite) TestDetachedWriter(c *gc.C) {
+	var out bytes.Buffer
+	defer PatchValue(&LeakedLogOutput, &out).Restore()
+	before := len(LeakedLogEntries())
+
+	w := &gocheckWriter{c: c, testName: "S.TestLeaky"}
+	w.Write(loggo.Entry{Level: loggo.INFO, Module: "test", Message: "in time"})
+	w.detach()
+	w.Write(loggo.Entry{
+		Level:    loggo.INFO,
+		Module:   "test",
+		Filename: "/src/worker.go",
+		Line:     12,
+		Message:  "too late",
+	})
+
+	c.Check(w.entries, gc.HasLen, 1)
+	c.Check(c.GetTestLog(), gc.Not(gc.Matches), "(?s).*too late.*")
+	leaked := LeakedLogEntries()[before:]
+	c.Assert(leaked, gc.HasLen, 1)
+	c.Check(leaked[0].Message, gc.Equals, "too late")
+	c.Check(leaked[0].After, gc.Equals, "S.TestLeaky")
+	c.Check(out.String(), gc.Matches,
+		`leaked log entry from unknown test \(after S.TestLeaky\): INFO test worker.go:12 too late \[goroutine created by .*\]\n`)
+}
+
+// leakySuite is run by TestLeakedFromPreviousTest. Its first test
+// starts a goroutine which logs while the second test is running.
+type leakySuite struct {
+	LoggingSuite
+	logNow chan struct{}
+	logged chan struct{}
+}
+
+func (s *leakySuite) Test1StartsGoroutine(c *gc.C) {
+	go func() {
+		<-s.logNow
+		loggo.GetLogger("test.leaky").Infof("logged late")
+		close(s.logged)
+	}()
+}
+
+func (s *leakySuite) Test2Runs(c *gc.C) {
+	close(s.logNow)
+	<-s.logged
+	loggo.GetLogger("test.leaky").Infof("logged in time")
+	c.Check(s.LogEntries(), gc.HasLen, 1)
+}
+
+func (*leakedLogSuite) TestLeakedFromPreviousTest(c *gc.C) {
+	var out bytes.Buffer
+	defer PatchValue(&LeakedLogOutput, &out).Restore()
+	before := len(LeakedLogEntries())
+
+	suite := &leakySuite{
+		logNow: make(chan struct{}),
+		logged: make(chan struct{}),
+	}
+	var output bytes.Buffer
+	result := gc.Run(suite, &gc.RunConf{Output: &output})
+	c.Assert(result.Passed(), gc.Equals, true, gc.Commentf("%s", output.String()))
+
+	leaked := LeakedLogEntries()[before:]
+	c.Assert(leaked, gc.HasLen, 1)
+	c.Check(leaked[0].Message, gc.Equals, "logged late")
+	c.Check(leaked[0].Test, gc.Equals, "leakySuite.Test1StartsGoroutine")
+	c.Check(strings.HasPrefix(leaked[0].CreatedBy, "github.com/juju/testing.(*leakySuite).Test1StartsGoroutine at "), gc.Equals, true)
+	c.Check(out.String(), gc.Matches, `leaked log entry from leakySuite.Test1StartsGoroutine: INFO test.leaky leakedlog_test.go:\d+ logged late .*\n`)
+}
+
+func (*leakedLogSuite) TestFinishedTestsWithoutGoroutinesAreForgotten(c *gc.C) {
+	leakedLog.mu.Lock()
+	tests, finished := leakedLog.tests, leakedLog.finished
+	leakedLog.tests = make(map[uint64]string)
+	leakedLog.finished = make(map[uint64]string)
+	leakedLog.mu.Unlock()
+	defer func() {
+		leakedLog.mu.Lock()
+		leakedLog.tests, leakedLog.finished = tests, finished
+		leakedLog.mu.Unlock()
+	}()
+	finishTest := func(id uint64, name string) {
+		leakedLog.mu.Lock()
+		leakedLog.tests[id] = name
+		leakedLog.mu.Unlock()
+		finishTestGoroutine(id)
+	}
+
+	// A test that leaves no goroutines running is forgotten
+	// as soon as it finishes, so that nothing is looked for.
+	finishTest(1<<62, "S.TestQuiet")
+	c.Check(haveFinishedTests(), gc.Equals, false)
+
+	// A test that leaves a goroutine running is remembered
+	// until the goroutine has gone. Act as the goroutine
+	// running the test, so that the goroutine started here
+	// is attributed to it.
+	var self uint64
+	_, err := fmt.Sscanf(string(currentStack()), "goroutine %d ", &self)
+	c.Assert(err, gc.IsNil)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		<-stop
+	}()
+	finishTest(self, "S.TestLeaky")
+	c.Check(haveFinishedTests(), gc.Equals, true)
+	stack := fmt.Sprintf("goroutine 1000 [running]:\ncreated by example.com/pkg.(*S).Test in goroutine %d\n\t/src/pkg/foo_test.go:34 +0x1d\n", self)
+	test, _, leaked := leakedBy([]byte(stack))
+	c.Check(leaked, gc.Equals, true)
+	c.Check(test, gc.Equals, "S.TestLeaky")
+
+	close(stop)
+	<-done
+	// The goroutine may take a moment to exit after closing done.
+	timeout := time.After(LongWait)
+	for haveFinishedTests() {
+		select {
+		case <-time.After(10 * time.Millisecond):
+		case <-timeout:
+			c.Fatalf("finished test still tracked after its goroutine exited")
+		}
+		finishTest(1<<62, "S.TestQuiet")
+	}
+	_, _, leaked = leakedBy([]byte(stack))
+	c.Check(leaked, gc.Equals, false)
+}
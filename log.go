@@ -8,19 +8,124 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/juju/loggo/v2"
 	gc "gopkg.in/check.v1"
+
+	jc "github.com/juju/testing/checkers"
 )
 
 var logLocation = flag.Bool("loggo.location", false, "Also log the location of the loggo call")
 
+var logOnFailure = flag.Bool("loggo.onfailure", false, "Only write the log of a test if the test fails")
+
 // LoggingSuite redirects the juju logger to the test logger
-// when embedded in a gocheck suite type.
-type LoggingSuite struct{}
+// when embedded in a gocheck suite type. It also keeps the
+// entries logged by each test so that they can be checked
+// with LogEntries and CheckLog.
+//
+// Records logged with the default slog logger are treated
+// in the same way, as entries of the "slog" module with the
+// attributes of the records as labels. The previous default
+// slog logger is restored when the suite is torn down.
+//
+// If the TEST_LOGGING_DIR environment variable is set, the
+// entries logged by each test are also written as JSON lines
+// to a file in that directory named after the test, for
+// example "MySuite.TestSomething.jsonl".
+type LoggingSuite struct {
+	// LogOnFailure causes the log of each test to be held
+	// back until the test has finished, and only written
+	// if the test failed. It is also enabled for all suites
+	// by the -loggo.onfailure flag.
+	//
+	// A test is considered to have failed if gocheck has
+	// reported a problem in its log, as it does for failed
+	// checks and assertions, errors and panics. Tests that
+	// fail by calling c.Fail without reporting anything
+	// will not have their log written.
+	LogOnFailure bool
+
+	// FailOnLogLevel, if set, causes the suite to fail if any of
+	// its tests logs entries at or above the given level, except those
+	// declared beforehand with ExpectLog.
+	//
+	// Gocheck gives fixtures no way to fail the test they run for,
+	// and a failure in TearDownTest would make it skip the rest of
+	// the suite. So the unexpected entries of each test are written
+	// to its log by TearDownTest, and TearDownSuite fails, listing
+	// the offending tests and their entries, once all the tests in
+	// the suite have run.
+	FailOnLogLevel loggo.Level
+
+	writer *gocheckWriter
+
+	// unexpected holds a report for each test that
+	// logged unexpected entries.
+	unexpected []string
+
+	// suiteSlog and testSlog hold the slog state to restore
+	// at the end of the suite and the current test.
+	suiteSlog *slogState
+	testSlog  *slogState
+}
 
 type gocheckWriter struct {
 	c *gc.C
+
+	// testName holds the name of the test the writer was
+	// created for, if any.
+	testName string
+
+	// testGoroutine holds the id of the goroutine running
+	// the test, if known.
+	testGoroutine uint64
+
+	// buffered holds whether output is held back in pending
+	// rather than written to c as each entry arrives.
+	buffered bool
+
+	// failLevel holds the level at or above which entries must
+	// be matched by an expectation. UNSPECIFIED disables the check.
+	failLevel loggo.Level
+
+	// mu guards the fields below it.
+	mu sync.Mutex
+	// entries holds all the entries written since the
+	// writer was created or last cleared.
+	entries []loggo.Entry
+	// pending holds the entries that have not yet been
+	// written to c, when buffered is true.
+	pending []loggo.Entry
+	// expected holds the expectations declared with ExpectLog.
+	expected []logExpectation
+	// unexpected holds the entries at or above failLevel that
+	// did not match any expectation when they were written.
+	unexpected []loggo.Entry
+	// detached holds whether the test has been torn down, after
+	// which all entries are reported as leaked.
+	detached bool
+	// artifact holds the file that entries are written to
+	// when TEST_LOGGING_DIR is set.
+	artifact *logArtifact
+}
+
+// logExpectation holds an entry that a test has declared
+// it expects to log.
+type logExpectation struct {
+	level   loggo.Level
+	message *regexp.Regexp
+}
+
+func (e logExpectation) match(entry loggo.Entry) bool {
+	if e.level != loggo.UNSPECIFIED && e.level != entry.Level {
+		return false
+	}
+	return e.message.MatchString(entry.Message)
 }
 
 var logConfig = func() string {
@@ -31,33 +136,210 @@ var logConfig = func() string {
 }()
 
 func (w *gocheckWriter) Write(entry loggo.Entry) {
-	filename := filepath.Base(entry.Filename)
-	var message string
-	if *logLocation {
-		message = fmt.Sprintf("%s %s %s:%d %s", entry.Level, entry.Module, filename, entry.Line, entry.Message)
-	} else {
-		message = fmt.Sprintf("%s %s %s", entry.Level, entry.Module, entry.Message)
+	if leaked, ok := w.leaked(entry); ok {
+		reportLeakedEntry(leaked)
+		return
+	}
+	w.mu.Lock()
+	w.entries = append(w.entries, entry)
+	if w.failLevel != loggo.UNSPECIFIED && entry.Level >= w.failLevel && !w.isExpected(entry) {
+		w.unexpected = append(w.unexpected, entry)
 	}
+	if w.artifact != nil {
+		w.artifact.write(entry)
+	}
+	if w.buffered {
+		w.pending = append(w.pending, entry)
+		w.mu.Unlock()
+		return
+	}
+	w.mu.Unlock()
+
 	// Magic calldepth value...
 	// The value says "how far up the call stack do we go to find the location".
 	// It is used to match the standard library log function, and isn't actually
 	// used by gocheck.
-	w.c.Output(3, message)
+	w.c.Output(3, formatEntry(entry))
+}
+
+// leaked reports whether the given entry was written after
+// the test that caused it had finished, either because the
+// writer has been detached, or because the entry was written
+// by a goroutine started by a test that has since finished.
+// The stack of the caller is only inspected when the writer
+// is detached or a finished test has left goroutines running,
+// as that is costly to do on every write.
+func (w *gocheckWriter) leaked(entry loggo.Entry) (LeakedLogEntry, bool) {
+	w.mu.Lock()
+	detached := w.detached
+	w.mu.Unlock()
+	if !detached && !haveFinishedTests() {
+		return LeakedLogEntry{}, false
+	}
+	test, createdBy, leaked := leakedBy(currentStack())
+	if !leaked && !detached {
+		return LeakedLogEntry{}, false
+	}
+	leakedEntry := LeakedLogEntry{
+		Entry:     entry,
+		Test:      test,
+		CreatedBy: createdBy,
+	}
+	if detached {
+		leakedEntry.After = w.testName
+	}
+	return leakedEntry, true
+}
+
+// detach stops the writer from writing to its test log,
+// so that any further entries are reported as leaked. It
+// returns any error from closing the log artifact.
+func (w *gocheckWriter) detach() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.detached = true
+	finishTestGoroutine(w.testGoroutine)
+	if w.artifact == nil {
+		return nil
+	}
+	err := w.artifact.close()
+	w.artifact = nil
+	return err
+}
+
+// isExpected reports whether the entry matches any of the
+// declared expectations. It is called with w.mu held.
+func (w *gocheckWriter) isExpected(entry loggo.Entry) bool {
+	for _, e := range w.expected {
+		if e.match(entry) {
+			return true
+		}
+	}
+	return false
+}
+
+// takePending returns the pending entries and the unexpected
+// entries, and resets both.
+func (w *gocheckWriter) takePending() (pending, unexpected []loggo.Entry) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	pending, unexpected = w.pending, w.unexpected
+	w.pending, w.unexpected = nil, nil
+	return pending, unexpected
+}
+
+// writePending writes the given buffered entries to c.
+func writePending(c *gc.C, pending []loggo.Entry) {
+	if len(pending) == 0 {
+		return
+	}
+	c.Output(2, fmt.Sprintf("test failed; %d buffered log entries follow", len(pending)))
+	for _, entry := range pending {
+		c.Output(2, formatEntry(entry))
+	}
+}
+
+// testFailed reports whether the given test log holds a
+// problem reported by gocheck. Fixtures cannot see the status
+// of the test they run for, but gocheck logs every problem it
+// finds with lines that start with "... ".
+func testFailed(log string) bool {
+	return strings.HasPrefix(log, "... ") || strings.Contains(log, "\n... ")
+}
+
+func formatEntry(entry loggo.Entry) string {
+	filename := filepath.Base(entry.Filename)
+	if *logLocation {
+		return fmt.Sprintf("%s %s %s:%d %s", entry.Level, entry.Module, filename, entry.Line, entry.Message)
+	}
+	return fmt.Sprintf("%s %s %s", entry.Level, entry.Module, entry.Message)
 }
 
 func (s *LoggingSuite) SetUpSuite(c *gc.C) {
-	s.setUp(c)
+	s.setUp(c, &gocheckWriter{c: c})
+	s.suiteSlog = installSlogHandler(s.writer)
 }
 
 func (s *LoggingSuite) TearDownSuite(c *gc.C) {
+	if len(s.unexpected) > 0 {
+		c.Errorf("%d tests logged unexpected entries at or above %s:\n%s",
+			len(s.unexpected), s.FailOnLogLevel, strings.Join(s.unexpected, "\n"))
+		s.unexpected = nil
+	}
 	loggo.ResetLogging()
+	s.testSlog.restore()
+	s.testSlog = nil
+	s.suiteSlog.restore()
+	s.suiteSlog = nil
 }
 
 func (s *LoggingSuite) SetUpTest(c *gc.C) {
-	s.setUp(c)
+	writer := &gocheckWriter{
+		c:             c,
+		testName:      c.TestName(),
+		testGoroutine: startTestGoroutine(c.TestName()),
+		buffered:      s.LogOnFailure || *logOnFailure,
+		failLevel:     s.FailOnLogLevel,
+	}
+	if logArtifactDir != "" {
+		artifact, err := createLogArtifact(logArtifactDir, c.TestName())
+		c.Assert(err, gc.IsNil)
+		writer.artifact = artifact
+	}
+	s.setUp(c, writer)
+	s.testSlog = installSlogHandler(writer)
 }
 
 func (s *LoggingSuite) TearDownTest(c *gc.C) {
+	s.testSlog.restore()
+	s.testSlog = nil
+	if s.writer == nil {
+		return
+	}
+	// Any entries written after the test has been torn
+	// down would be attributed to the wrong test.
+	defer func() {
+		err := s.writer.detach()
+		c.Check(err, gc.IsNil, gc.Commentf("cannot write log artifact"))
+	}()
+	pending, unexpected := s.writer.takePending()
+	if len(unexpected) > 0 {
+		lines := make([]string, len(unexpected))
+		for i, entry := range unexpected {
+			lines[i] = fmt.Sprintf("%s %s %s:%d %s",
+				entry.Level, entry.Module, filepath.Base(entry.Filename), entry.Line, entry.Message)
+		}
+		report := fmt.Sprintf("%s logged %d unexpected entries at or above %s:\n%s",
+			c.TestName(), len(unexpected), s.FailOnLogLevel, strings.Join(lines, "\n"))
+		s.unexpected = append(s.unexpected, report)
+		// The writer's C shares its log with the test, so the
+		// report and any held back entries appear in the
+		// test's log when it is shown, as with -check.vv.
+		s.writer.c.Output(1, report)
+		writePending(s.writer.c, pending)
+		return
+	}
+	if testFailed(s.writer.c.GetTestLog()) {
+		writePending(s.writer.c, pending)
+	}
+}
+
+// ExpectLog declares that the current test may log entries at
+// the given level with messages matching the given regular
+// expression, so that they do not cause the test to fail when
+// FailOnLogLevel is set. The expression must match the whole
+// message. If level is UNSPECIFIED, entries at any level match.
+func (s *LoggingSuite) ExpectLog(level loggo.Level, message string) {
+	if s.writer == nil {
+		panic("ExpectLog called before SetUpTest")
+	}
+	e := logExpectation{
+		level:   level,
+		message: regexp.MustCompile("^(?:" + message + ")$"),
+	}
+	s.writer.mu.Lock()
+	defer s.writer.mu.Unlock()
+	s.writer.expected = append(s.writer.expected, e)
 }
 
 type discardWriter struct{}
@@ -65,17 +347,97 @@ type discardWriter struct{}
 func (discardWriter) Write(entry loggo.Entry) {
 }
 
-func (s *LoggingSuite) setUp(c *gc.C) {
+func (s *LoggingSuite) setUp(c *gc.C, writer *gocheckWriter) {
 	loggo.ResetLogging()
 	// Don't use the default writer for the test logging, which
 	// means we can still get logging output from tests that
 	// replace the default writer.
 	loggo.RegisterWriter(loggo.DefaultWriterName, discardWriter{})
-	loggo.RegisterWriter("loggingsuite", &gocheckWriter{c})
+	s.writer = writer
+	loggo.RegisterWriter("loggingsuite", s.writer)
 	err := loggo.ConfigureLoggers(logConfig)
 	c.Assert(err, gc.IsNil)
 }
 
+// LogEntries returns the entries that have been logged since the
+// current test was set up or ClearLog was last called.
+func (s *LoggingSuite) LogEntries() []loggo.Entry {
+	if s.writer == nil {
+		return nil
+	}
+	s.writer.mu.Lock()
+	defer s.writer.mu.Unlock()
+	entries := make([]loggo.Entry, len(s.writer.entries))
+	copy(entries, s.writer.entries)
+	return entries
+}
+
+// ClearLog discards the entries that have been logged so far,
+// so that subsequent calls to LogEntries and CheckLog only see
+// entries logged after this call.
+func (s *LoggingSuite) ClearLog() {
+	if s.writer == nil {
+		return
+	}
+	s.writer.mu.Lock()
+	defer s.writer.mu.Unlock()
+	s.writer.entries = nil
+}
+
+// CheckLog checks that the entries logged so far match the
+// expected messages as described by checkers.LogMatches.
+// It reports whether the check succeeded.
+func (s *LoggingSuite) CheckLog(c *gc.C, expected ...jc.SimpleMessage) bool {
+	return s.CheckLogFiltered(c, LogFilter{}, expected...)
+}
+
+// CheckLogFiltered is like CheckLog but only checks the entries
+// that are selected by the given filter.
+func (s *LoggingSuite) CheckLogFiltered(c *gc.C, filter LogFilter, expected ...jc.SimpleMessage) bool {
+	return c.Check(filter.Filter(s.LogEntries()), jc.LogMatches, jc.SimpleMessages(expected))
+}
+
+// LogFilter selects log entries by module and time.
+// The zero value selects all entries.
+type LogFilter struct {
+	// Module, if not empty, selects entries logged
+	// by the named module or any of its submodules.
+	Module string
+
+	// Since, if not zero, selects entries logged
+	// at or after the given time.
+	Since time.Time
+
+	// Until, if not zero, selects entries logged
+	// before the given time.
+	Until time.Time
+}
+
+// Filter returns the entries selected by the filter.
+func (f LogFilter) Filter(entries []loggo.Entry) []loggo.Entry {
+	var selected []loggo.Entry
+	for _, entry := range entries {
+		if f.Match(entry) {
+			selected = append(selected, entry)
+		}
+	}
+	return selected
+}
+
+// Match reports whether the given entry is selected by the filter.
+func (f LogFilter) Match(entry loggo.Entry) bool {
+	if f.Module != "" && entry.Module != f.Module && !strings.HasPrefix(entry.Module, f.Module+".") {
+		return false
+	}
+	if !f.Since.IsZero() && entry.Timestamp.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !entry.Timestamp.Before(f.Until) {
+		return false
+	}
+	return true
+}
+
 // LoggingCleanupSuite is defined for backward compatibility.
 // Do not use this suite in new tests.
 type LoggingCleanupSuite struct {
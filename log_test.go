@@ -4,9 +4,18 @@
 package testing
 
 import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
 	gc "gopkg.in/check.v1"
 
 	"github.com/juju/loggo/v2"
+
+	jc "github.com/juju/testing/checkers"
 )
 
 type logSuite struct{}
@@ -45,3 +54,215 @@ func (*logSuite) TestLog(c *gc.C) {
 	c.Assert(logger.EffectiveLogLevel(), gc.Equals, loggo.WARNING)
 	c.Assert(jujuLogger.EffectiveLogLevel(), gc.Equals, loggo.WARNING)
 }
+
+func (*logSuite) TestLogEntries(c *gc.C) {
+	var suite LoggingSuite
+	c.Assert(suite.LogEntries(), gc.HasLen, 0)
+	suite.SetUpTest(c)
+	defer suite.TearDownSuite(c)
+
+	logger := loggo.GetLogger("test.entries")
+	logger.Infof("message 1")
+	logger.Debugf("message 2")
+
+	entries := suite.LogEntries()
+	c.Assert(entries, gc.HasLen, 2)
+	c.Check(entries[0].Module, gc.Equals, "test.entries")
+	c.Check(entries[0].Level, gc.Equals, loggo.INFO)
+	c.Check(entries[0].Message, gc.Equals, "message 1")
+	c.Check(entries[1].Message, gc.Equals, "message 2")
+
+	suite.CheckLog(c,
+		jc.SimpleMessage{Level: loggo.INFO, Message: "message 1"},
+		jc.SimpleMessage{Level: loggo.DEBUG, Message: "message 2"},
+	)
+
+	suite.ClearLog()
+	c.Assert(suite.LogEntries(), gc.HasLen, 0)
+	logger.Infof("message 3")
+	suite.CheckLog(c, jc.SimpleMessage{Level: loggo.INFO, Message: "message 3"})
+}
+
+func (*logSuite) TestCheckLogFiltered(c *gc.C) {
+	var suite LoggingSuite
+	suite.SetUpTest(c)
+	defer suite.TearDownSuite(c)
+
+	loggo.GetLogger("test.filter").Infof("first")
+	loggo.GetLogger("test.filtered").Infof("other module")
+	loggo.GetLogger("test.filter.child").Infof("child")
+
+	suite.CheckLogFiltered(c, LogFilter{Module: "test.filter"},
+		jc.SimpleMessage{Level: loggo.INFO, Message: "first"},
+		jc.SimpleMessage{Level: loggo.INFO, Message: "child"},
+	)
+	c.Check(LogFilter{Module: "test.filter"}.Filter(suite.LogEntries()), gc.HasLen, 2)
+	c.Check(LogFilter{Module: "test"}.Filter(suite.LogEntries()), gc.HasLen, 3)
+}
+
+func (*logSuite) TestLogFilterTime(c *gc.C) {
+	t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	entries := []loggo.Entry{
+		{Message: "a", Timestamp: t0},
+		{Message: "b", Timestamp: t0.Add(time.Second)},
+		{Message: "c", Timestamp: t0.Add(2 * time.Second)},
+	}
+	filtered := LogFilter{
+		Since: t0.Add(time.Second),
+		Until: t0.Add(2 * time.Second),
+	}.Filter(entries)
+	c.Assert(filtered, gc.HasLen, 1)
+	c.Assert(filtered[0].Message, gc.Equals, "b")
+
+	c.Assert(LogFilter{}.Filter(entries), jc.DeepEquals, entries)
+}
+
+func (*logSuite) TestLogOnFailurePassed(c *gc.C) {
+	suite := LoggingSuite{LogOnFailure: true}
+	suite.SetUpTest(c)
+	defer suite.TearDownSuite(c)
+
+	loggo.GetLogger("test").Infof("held back")
+	c.Check(suite.LogEntries(), gc.HasLen, 1)
+	suite.TearDownTest(c)
+	c.Assert(c.GetTestLog(), gc.Not(gc.Matches), "(?s).*held back.*")
+}
+
+func (*logSuite) TestLogOnFailureFailed(c *gc.C) {
+	suite := LoggingSuite{LogOnFailure: true}
+	suite.SetUpTest(c)
+	defer suite.TearDownSuite(c)
+
+	loggo.GetLogger("test").Infof("held back")
+	c.Assert(c.GetTestLog(), gc.Not(gc.Matches), "(?s).*held back.*")
+	// Simulate the report gocheck logs for a failed check.
+	c.Log("log_test.go:99:\n    c.Check(1, gc.Equals, 2)\n... obtained int = 1\n... expected int = 2")
+	suite.TearDownTest(c)
+	c.Assert(c.GetTestLog(), gc.Matches, "(?s).*test failed; 1 buffered log entries follow\n.*INFO test held back\n")
+}
+
+func (*logSuite) TestTestFailed(c *gc.C) {
+	c.Check(testFailed(""), gc.Equals, false)
+	c.Check(testFailed("INFO juju some message\n"), gc.Equals, false)
+	c.Check(testFailed("... Error: something\n"), gc.Equals, true)
+	c.Check(testFailed("INFO juju some message\nfoo_test.go:10:\n    c.Fatalf(\"x\")\n... Error: x\n"), gc.Equals, true)
+}
+
+// failOnLogSuite is run by TestFailOnLogLevel to check the
+// behaviour of LoggingSuite.FailOnLogLevel.
+type failOnLogSuite struct {
+	LoggingSuite
+}
+
+func (s *failOnLogSuite) TestExpected(c *gc.C) {
+	s.ExpectLog(loggo.ERROR, "cannot connect.*")
+	loggo.GetLogger("test").Errorf("cannot connect to server")
+	loggo.GetLogger("test").Infof("below the level")
+}
+
+func (s *failOnLogSuite) TestUnexpected(c *gc.C) {
+	s.ExpectLog(loggo.ERROR, "cannot connect.*")
+	loggo.GetLogger("test.unexpected").Warningf("something odd")
+	loggo.GetLogger("test").Errorf("not cannot connect")
+}
+
+func (s *failOnLogSuite) TestNotYetExpected(c *gc.C) {
+	loggo.GetLogger("test").Errorf("cannot connect to server")
+	s.ExpectLog(loggo.ERROR, "cannot connect.*")
+}
+
+func (*logSuite) TestFailOnLogLevel(c *gc.C) {
+	run := func(test string) (*gc.Result, string) {
+		var output bytes.Buffer
+		suite := &failOnLogSuite{
+			LoggingSuite: LoggingSuite{FailOnLogLevel: loggo.WARNING},
+		}
+		result := gc.Run(suite, &gc.RunConf{
+			Output: &output,
+			Filter: test + "$",
+		})
+		return result, output.String()
+	}
+
+	result, _ := run("TestExpected")
+	c.Check(result.Succeeded, gc.Equals, 1)
+	c.Check(result.Passed(), jc.IsTrue)
+
+	result, output := run("TestUnexpected")
+	c.Check(result.Passed(), jc.IsFalse)
+	c.Check(output, gc.Matches, `(?s).*`+
+		`failOnLogSuite.TestUnexpected logged 2 unexpected entries at or above WARNING:\n`+
+		`WARNING test.unexpected log_test.go:\d+ something odd\n`+
+		`ERROR test log_test.go:\d+ not cannot connect\n.*`)
+
+	result, output = run("TestNotYetExpected")
+	c.Check(result.Passed(), jc.IsFalse)
+	c.Check(output, gc.Matches, `(?s).*`+
+		`failOnLogSuite.TestNotYetExpected logged 1 unexpected entries at or above WARNING:\n`+
+		`ERROR test log_test.go:\d+ cannot connect to server\n.*`)
+}
+
+func (*logSuite) TestFailOnLogLevelWholeSuite(c *gc.C) {
+	// All the tests in the suite run, and the suite
+	// fails listing only the tests that logged
+	// unexpected entries.
+	var output bytes.Buffer
+	suite := &failOnLogSuite{
+		LoggingSuite: LoggingSuite{FailOnLogLevel: loggo.WARNING},
+	}
+	result := gc.Run(suite, &gc.RunConf{Output: &output})
+	c.Check(result.Succeeded, gc.Equals, 3)
+	c.Check(result.Missed, gc.Equals, 0)
+	c.Check(result.Passed(), jc.IsFalse)
+	c.Check(output.String(), gc.Matches, `(?s).*FAIL: .*failOnLogSuite.TearDownSuite\n.*`+
+		`\.\.\. Error: 2 tests logged unexpected entries at or above WARNING:\n.*`)
+	c.Check(output.String(), gc.Matches, `(?s).*failOnLogSuite.TestUnexpected logged 2 unexpected entries.*`)
+	c.Check(output.String(), gc.Matches, `(?s).*failOnLogSuite.TestNotYetExpected logged 1 unexpected entries.*`)
+	c.Check(output.String(), gc.Not(gc.Matches), `(?s).*TestExpected logged.*`)
+}
+
+// artifactSuite is run by TestLogArtifacts.
+type artifactSuite struct {
+	LoggingSuite
+}
+
+func (s *artifactSuite) TestSomething(c *gc.C) {
+	loggo.GetLogger("test.artifact").WithLabels(loggo.Labels{"key": "value"}).Infof("first message")
+	loggo.GetLogger("test.artifact").Debugf("second\nmessage")
+}
+
+func (*logSuite) TestLogArtifacts(c *gc.C) {
+	dir := filepath.Join(c.MkDir(), "logs")
+	defer PatchValue(&logArtifactDir, dir).Restore()
+
+	var output bytes.Buffer
+	result := gc.Run(&artifactSuite{}, &gc.RunConf{Output: &output})
+	c.Assert(result.Passed(), gc.Equals, true, gc.Commentf("%s", output.String()))
+
+	data, err := os.ReadFile(filepath.Join(dir, "artifactSuite.TestSomething.jsonl"))
+	c.Assert(err, jc.ErrorIsNil)
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	c.Assert(lines, gc.HasLen, 2)
+
+	var entries []jsonLogEntry
+	for _, line := range lines {
+		var entry jsonLogEntry
+		err := json.Unmarshal([]byte(line), &entry)
+		c.Assert(err, jc.ErrorIsNil)
+		c.Check(entry.Timestamp.IsZero(), gc.Equals, false)
+		c.Check(filepath.Base(entry.File), gc.Equals, "log_test.go")
+		c.Check(entry.Line, jc.GreaterThan, 0)
+		entry.Timestamp, entry.File, entry.Line = time.Time{}, "", 0
+		entries = append(entries, entry)
+	}
+	c.Assert(entries, jc.DeepEquals, []jsonLogEntry{{
+		Level:   "INFO",
+		Module:  "test.artifact",
+		Labels:  map[string]string{"key": "value"},
+		Message: "first message",
+	}, {
+		Level:   "DEBUG",
+		Module:  "test.artifact",
+		Message: "second\nmessage",
+	}})
+}
@@ -0,0 +1,88 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package testing
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/juju/loggo/v2"
+)
+
+// logArtifactDir holds the directory that LoggingSuite writes the
+// log of each test to. It is read when the package is initialised
+// because OsEnvSuite clears the environment before tests run.
+var logArtifactDir = os.Getenv("TEST_LOGGING_DIR")
+
+// jsonLogEntry holds the JSON representation of a loggo.Entry
+// as written to a log artifact.
+type jsonLogEntry struct {
+	Timestamp time.Time         `json:"timestamp"`
+	Level     string            `json:"level"`
+	Module    string            `json:"module"`
+	File      string            `json:"file"`
+	Line      int               `json:"line"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Message   string            `json:"message"`
+}
+
+// logArtifact writes the log entries of a single test to a file
+// as JSON lines.
+type logArtifact struct {
+	file *os.File
+	enc  *json.Encoder
+	// err holds the first error encountered when writing.
+	err error
+}
+
+// logArtifactPath returns the path of the log artifact
+// for the named test in the given directory.
+func logArtifactPath(dir, testName string) string {
+	return filepath.Join(dir, testName+".jsonl")
+}
+
+// createLogArtifact creates the log artifact for the named test
+// in the given directory, replacing any written by a previous run.
+func createLogArtifact(dir, testName string) (*logArtifact, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.Create(logArtifactPath(dir, testName))
+	if err != nil {
+		return nil, err
+	}
+	return &logArtifact{
+		file: f,
+		enc:  json.NewEncoder(f),
+	}, nil
+}
+
+// write writes the entry to the artifact. Any error is
+// remembered and returned by close.
+func (a *logArtifact) write(entry loggo.Entry) {
+	if a.err != nil {
+		return
+	}
+	a.err = a.enc.Encode(jsonLogEntry{
+		Timestamp: entry.Timestamp,
+		Level:     entry.Level.String(),
+		Module:    entry.Module,
+		File:      entry.Filename,
+		Line:      entry.Line,
+		Labels:    entry.Labels,
+		Message:   entry.Message,
+	})
+}
+
+// close closes the artifact, returning the first error
+// encountered while writing to it.
+func (a *logArtifact) close() error {
+	err := a.file.Close()
+	if a.err != nil {
+		return a.err
+	}
+	return err
+}
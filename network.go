@@ -0,0 +1,230 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package testing
+
+import (
+	"sync"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+// Network simulates a network between a set of nodes, such as
+// in-process servers, so that links between them can be cut and
+// restored. It runs a TCPProxy for each ordered pair of nodes, through
+// which the first node connects to the second, so each node must use
+// the addresses returned by PeerAddrs to connect to its peers.
+//
+// When a link is cut, traffic across existing connections is stopped
+// rather than discarded, as it would be if a real network were
+// partitioned, so data that was sent while the link was cut is
+// delivered when it is restored, unless the connection has been
+// closed in the meantime. New connections between two nodes are
+// refused while the link in either direction between them is cut,
+// as a connection cannot be set up without traffic flowing both
+// ways. They are reset straight away, rather than timing out as
+// they might on a real network, so that tests need not wait.
+//
+// Failures to connect to a node, such as one that a test has
+// stopped, are not reported as test errors; the connection from
+// the peer is closed instead. They are counted in the Failed
+// field of the statistics of the proxy between the nodes.
+type Network struct {
+	c *gc.C
+	// mu guards the fields below it.
+	mu sync.Mutex
+	// nodes holds the names of the nodes, in the order
+	// they were added.
+	nodes []string
+	// addrs holds the address of each node.
+	addrs map[string]string
+	// proxies holds the proxy for each ordered pair of nodes.
+	proxies map[networkLink]*TCPProxy
+	// cut holds the links that traffic cannot flow across.
+	cut map[networkLink]bool
+}
+
+// networkLink identifies the link that
+// traffic flows across from one node to another.
+type networkLink struct {
+	from, to string
+}
+
+// NewNetwork returns a new network with no nodes.
+// It should be closed when it is no longer needed.
+func NewNetwork(c *gc.C) *Network {
+	return &Network{
+		c:       c,
+		addrs:   make(map[string]string),
+		proxies: make(map[networkLink]*TCPProxy),
+		cut:     make(map[networkLink]bool),
+	}
+}
+
+// AddNode adds a node with the given name, listening on the given
+// TCP address, to the network. The node does not need to be listening
+// yet, as proxies connect to it only when a peer connects to them.
+// Links to the new node are not cut, even if links to existing nodes
+// have been cut.
+func (n *Network) AddNode(name, addr string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if _, ok := n.addrs[name]; ok {
+		n.c.Fatalf("node %q already added to network", name)
+	}
+	for _, node := range n.nodes {
+		n.proxies[networkLink{node, name}] = n.startProxy(addr)
+		n.proxies[networkLink{name, node}] = n.startProxy(n.addrs[node])
+	}
+	n.nodes = append(n.nodes, name)
+	n.addrs[name] = addr
+}
+
+// Nodes returns the names of the nodes in
+// the network, in the order they were added.
+func (n *Network) Nodes() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]string(nil), n.nodes...)
+}
+
+// PeerAddrs returns the addresses that the given node should connect
+// to in order to reach each of its peers, keyed by the name of the peer.
+func (n *Network) PeerAddrs(node string) map[string]string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.checkNodes(node)
+	addrs := make(map[string]string)
+	for _, peer := range n.nodes {
+		if peer != node {
+			addrs[peer] = n.proxies[networkLink{node, peer}].Addr()
+		}
+	}
+	return addrs
+}
+
+// Proxy returns the proxy through which the first node connects
+// to the second, so that faults can be injected into the connections
+// between them.
+func (n *Network) Proxy(from, to string) *TCPProxy {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.checkNodes(from, to)
+	if from == to {
+		n.c.Fatalf("no proxy from node %q to itself", from)
+	}
+	return n.proxies[networkLink{from, to}]
+}
+
+// Cut cuts the link from one node to another, so that traffic sent
+// by the first node does not reach the second, while traffic sent by
+// the second node still reaches the first.
+func (n *Network) Cut(from, to string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.checkNodes(from, to)
+	n.cut[networkLink{from, to}] = true
+	n.apply()
+}
+
+// Restore restores the link from one node to another that has been
+// cut, leaving the link in the other direction as it is.
+func (n *Network) Restore(from, to string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.checkNodes(from, to)
+	delete(n.cut, networkLink{from, to})
+	n.apply()
+}
+
+// Partition cuts the links in both directions between each node in
+// side1 and each node in side2. Links between nodes on the same side
+// are not affected.
+func (n *Network) Partition(side1, side2 []string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.checkNodes(side1...)
+	n.checkNodes(side2...)
+	for _, node1 := range side1 {
+		for _, node2 := range side2 {
+			n.cut[networkLink{node1, node2}] = true
+			n.cut[networkLink{node2, node1}] = true
+		}
+	}
+	n.apply()
+}
+
+// Isolate cuts the links in both directions between
+// the given node and all the other nodes.
+func (n *Network) Isolate(node string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.checkNodes(node)
+	for _, peer := range n.nodes {
+		if peer != node {
+			n.cut[networkLink{node, peer}] = true
+			n.cut[networkLink{peer, node}] = true
+		}
+	}
+	n.apply()
+}
+
+// Heal restores all the links that have been cut.
+func (n *Network) Heal() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.cut = make(map[networkLink]bool)
+	n.apply()
+}
+
+// Close closes all the proxies in the network
+// and all the connections through them.
+func (n *Network) Close() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, p := range n.proxies {
+		p.Close()
+	}
+	return nil
+}
+
+// startProxy starts a proxy to the node with the given address.
+// Errors from the proxy are ignored, as nodes may be stopped by
+// the test at any time.
+func (n *Network) startProxy(addr string) *TCPProxy {
+	p, err := StartTCPProxy(TCPProxyConfig{
+		RemoteAddr: addr,
+	})
+	n.c.Assert(err, jc.ErrorIsNil)
+	return p
+}
+
+// apply pauses each direction of each proxy that carries
+// traffic across a link that has been cut, and makes each
+// proxy between nodes that a cut link separates refuse
+// new connections.
+// It must be called with n.mu held.
+func (n *Network) apply() {
+	for link, p := range n.proxies {
+		// Traffic from a node that has connected to a peer
+		// flows from client to server, and traffic from the
+		// peer flows back from server to client.
+		fromCut := n.cut[link]
+		toCut := n.cut[networkLink{link.to, link.from}]
+		p.setDirPaused(ClientToServer, fromCut)
+		p.setDirPaused(ServerToClient, toCut)
+		p.SetRefuseConns(fromCut || toCut)
+	}
+}
+
+// checkNodes fails the test if any of the
+// given nodes is not in the network.
+// It must be called with n.mu held.
+func (n *Network) checkNodes(nodes ...string) {
+	for _, node := range nodes {
+		if _, ok := n.addrs[node]; !ok {
+			n.c.Fatalf("node %q not in network", node)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package testing_test
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+var _ = gc.Suite(&networkSuite{})
+
+type networkSuite struct{}
+
+func (*networkSuite) TestPeerAddrs(c *gc.C) {
+	n, closeNodes := newTestNetwork(c, "a", "b", "c")
+	defer closeNodes()
+	defer n.Close()
+
+	c.Assert(n.Nodes(), gc.DeepEquals, []string{"a", "b", "c"})
+	addrs := n.PeerAddrs("a")
+	c.Assert(addrs, gc.HasLen, 2)
+	c.Assert(addrs["b"], gc.Equals, n.Proxy("a", "b").Addr())
+	c.Assert(addrs["c"], gc.Equals, n.Proxy("a", "c").Addr())
+	c.Assert(addrs["b"], gc.Not(gc.Equals), n.PeerAddrs("c")["b"])
+
+	conn := dialPeer(c, n, "a", "b")
+	defer conn.Close()
+	assertGreeting(c, conn, "b")
+	assertEcho(c, conn)
+}
+
+func (*networkSuite) TestPartition(c *gc.C) {
+	n, closeNodes := newTestNetwork(c, "a", "b", "c")
+	defer closeNodes()
+	defer n.Close()
+
+	ab := dialPeer(c, n, "a", "b")
+	defer ab.Close()
+	assertGreeting(c, ab, "b")
+
+	n.Partition([]string{"a"}, []string{"b", "c"})
+	_, err := fmt.Fprint(ab, "hello, world\n")
+	c.Assert(err, gc.IsNil)
+	assertReadTimeout(c, ab)
+
+	// Links on the same side are not cut.
+	bc := dialPeer(c, n, "b", "c")
+	defer bc.Close()
+	assertGreeting(c, bc, "c")
+	assertEcho(c, bc)
+
+	// New connections across the partition are refused.
+	assertDialRefused(c, n, "c", "a")
+
+	// Data sent during the partition is delivered when it heals.
+	n.Heal()
+	_, err = io.ReadFull(ab, make([]byte, 13))
+	c.Assert(err, gc.IsNil)
+	assertEcho(c, ab)
+	ca := dialPeer(c, n, "c", "a")
+	defer ca.Close()
+	assertGreeting(c, ca, "a")
+}
+
+func (*networkSuite) TestIsolate(c *gc.C) {
+	n, closeNodes := newTestNetwork(c, "a", "b", "c")
+	defer closeNodes()
+	defer n.Close()
+
+	ab := dialPeer(c, n, "a", "b")
+	defer ab.Close()
+	assertGreeting(c, ab, "b")
+
+	n.Isolate("b")
+	_, err := fmt.Fprint(ab, "hello, world\n")
+	c.Assert(err, gc.IsNil)
+	assertReadTimeout(c, ab)
+	assertDialRefused(c, n, "a", "b")
+	assertDialRefused(c, n, "b", "a")
+	ac := dialPeer(c, n, "a", "c")
+	defer ac.Close()
+	assertGreeting(c, ac, "c")
+}
+
+func (*networkSuite) TestCut(c *gc.C) {
+	n, closeNodes := newTestNetwork(c, "a", "b")
+	defer closeNodes()
+	defer n.Close()
+
+	ab := dialPeer(c, n, "a", "b")
+	defer ab.Close()
+	assertGreeting(c, ab, "b")
+	ba := dialPeer(c, n, "b", "a")
+	defer ba.Close()
+	assertGreeting(c, ba, "a")
+
+	n.Cut("a", "b")
+
+	// Traffic from a does not reach b, and the echo
+	// of traffic from b cannot get back from a.
+	_, err := fmt.Fprint(ab, "hello, world\n")
+	c.Assert(err, gc.IsNil)
+	assertReadTimeout(c, ab)
+	_, err = fmt.Fprint(ba, "hello, world\n")
+	c.Assert(err, gc.IsNil)
+	assertReadTimeout(c, ba)
+
+	// New connections need traffic in both
+	// directions, so they are refused both ways.
+	assertDialRefused(c, n, "a", "b")
+	assertDialRefused(c, n, "b", "a")
+
+	n.Restore("a", "b")
+	_, err = io.ReadFull(ab, make([]byte, 13))
+	c.Assert(err, gc.IsNil)
+	_, err = io.ReadFull(ba, make([]byte, 13))
+	c.Assert(err, gc.IsNil)
+	ab2 := dialPeer(c, n, "a", "b")
+	defer ab2.Close()
+	assertGreeting(c, ab2, "b")
+}
+
+func (*networkSuite) TestStoppedNode(c *gc.C) {
+	n, closeNodes := newTestNetwork(c, "a", "b")
+	defer n.Close()
+
+	// Connecting to a node that has stopped does
+	// not fail the test, and the connection is closed.
+	closeNodes()
+	ab := dialPeer(c, n, "a", "b")
+	defer ab.Close()
+	assertEOF(c, ab)
+	c.Assert(n.Proxy("a", "b").Stats().Failed, gc.Equals, 1)
+}
+
+// newTestNetwork returns a network of nodes with the given names,
+// and a function that stops the nodes. Each node writes its name
+// to each peer that connects to it, and then echoes anything that
+// the peer writes.
+func newTestNetwork(c *gc.C, names ...string) (*testing.Network, func()) {
+	n := testing.NewNetwork(c)
+	var listeners []net.Listener
+	for _, name := range names {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		c.Assert(err, gc.IsNil)
+		listeners = append(listeners, listener)
+		go greetAndEcho(listener, name)
+		n.AddNode(name, listener.Addr().String())
+	}
+	return n, func() {
+		for _, listener := range listeners {
+			listener.Close()
+		}
+	}
+}
+
+// greetAndEcho accepts connections on the listener, writing the
+// given name to each connection and then echoing anything written.
+func greetAndEcho(listener net.Listener, name string) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			fmt.Fprintln(conn, name)
+			io.Copy(conn, conn)
+		}()
+	}
+}
+
+func dialPeer(c *gc.C, n *testing.Network, from, to string) net.Conn {
+	conn, err := net.Dial("tcp", n.PeerAddrs(from)[to])
+	c.Assert(err, gc.IsNil)
+	return conn
+}
+
+// assertDialRefused checks that a connection from one
+// node to another is refused without reaching the other
+// node.
+func assertDialRefused(c *gc.C, n *testing.Network, from, to string) {
+	refused := n.Proxy(from, to).Stats().Refused
+	conn, err := net.Dial("tcp", n.PeerAddrs(from)[to])
+	if err == nil {
+		defer conn.Close()
+		err = conn.SetReadDeadline(time.Now().Add(testing.LongWait))
+		c.Assert(err, gc.IsNil)
+		_, err = conn.Read(make([]byte, 1))
+		c.Assert(err, gc.NotNil)
+		c.Assert(err, gc.Not(jc.Satisfies), os.IsTimeout)
+	}
+	c.Assert(n.Proxy(from, to).Stats().Refused, gc.Equals, refused+1)
+}
+
+func assertGreeting(c *gc.C, conn net.Conn, name string) {
+	line, err := bufio.NewReader(io.LimitReader(conn, int64(len(name)+1))).ReadString('\n')
+	c.Assert(err, gc.IsNil)
+	c.Assert(line, gc.Equals, name+"\n")
+}
@@ -4,11 +4,19 @@
 package testing_test
 
 import (
+	"os"
 	stdtesting "testing"
 
 	gc "gopkg.in/check.v1"
+
+	"github.com/juju/testing"
 )
 
+func TestMain(m *stdtesting.M) {
+	testing.RunExecHelperProcess()
+	os.Exit(m.Run())
+}
+
 func Test(t *stdtesting.T) {
 	gc.TestingT(t)
 }
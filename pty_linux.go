@@ -0,0 +1,328 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package testing
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+
+	gc "gopkg.in/check.v1"
+
+	jc "github.com/juju/testing/checkers"
+)
+
+// PseudoTerminal drives a command or function attached to a pseudo-terminal,
+// so that code which prompts for input or behaves differently when writing
+// to a terminal can be tested. Any failure reported by its methods includes
+// a transcript of everything written to the terminal so far.
+type PseudoTerminal struct {
+	// Timeout holds the time that Expect and Wait wait before
+	// failing the test. It defaults to LongWait.
+	Timeout time.Duration
+
+	c      *gc.C
+	master *os.File
+
+	// done is closed when the command or function has finished,
+	// after which err holds its result.
+	done chan struct{}
+	err  error
+	// kill, if not nil, kills the running command.
+	kill func()
+
+	// readDone is closed when there is nothing more to read.
+	readDone chan struct{}
+
+	// mu guards the fields below it.
+	mu sync.Mutex
+	// output holds everything read from the terminal.
+	output []byte
+	// pos holds the position in output after the last match.
+	pos int
+	// changed is closed and replaced when output changes.
+	changed chan struct{}
+}
+
+// StartPTY starts the given command with its standard input, output and
+// error attached to a new pseudo-terminal, which is made its controlling
+// terminal. The command must not have been started. The returned
+// PseudoTerminal should be closed when it is no longer needed.
+func StartPTY(c *gc.C, cmd *exec.Cmd) *PseudoTerminal {
+	p, tty := newPseudoTerminal(c)
+	defer tty.Close()
+	cmd.Stdin = tty
+	cmd.Stdout = tty
+	cmd.Stderr = tty
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setsid = true
+	cmd.SysProcAttr.Setctty = true
+	// Ctty refers to a file descriptor in the child,
+	// which is standard input.
+	cmd.SysProcAttr.Ctty = 0
+	if err := cmd.Start(); err != nil {
+		p.master.Close()
+		c.Fatalf("cannot start command: %v", err)
+	}
+	p.kill = func() { cmd.Process.Kill() }
+	go func() {
+		defer close(p.done)
+		p.err = cmd.Wait()
+	}()
+	return p
+}
+
+// StartPTYFunc calls f in a new goroutine with the slave side of a new
+// pseudo-terminal, which it can use for its input and output. The
+// terminal is closed when f returns, and Wait returns the error returned
+// by f. The returned PseudoTerminal should be closed when it is no
+// longer needed.
+func StartPTYFunc(c *gc.C, f func(tty *os.File) error) *PseudoTerminal {
+	p, tty := newPseudoTerminal(c)
+	go func() {
+		defer close(p.done)
+		defer tty.Close()
+		p.err = f(tty)
+	}()
+	return p
+}
+
+func newPseudoTerminal(c *gc.C) (*PseudoTerminal, *os.File) {
+	master, tty, err := openPTY()
+	c.Assert(err, jc.ErrorIsNil)
+	p := &PseudoTerminal{
+		Timeout:  LongWait,
+		c:        c,
+		master:   master,
+		done:     make(chan struct{}),
+		readDone: make(chan struct{}),
+		changed:  make(chan struct{}),
+	}
+	go p.read()
+	return p, tty
+}
+
+// read reads the output of the terminal until it is closed.
+func (p *PseudoTerminal) read() {
+	defer close(p.readDone)
+	buf := make([]byte, 4096)
+	for {
+		n, err := p.master.Read(buf)
+		p.mu.Lock()
+		p.output = append(p.output, buf[:n]...)
+		close(p.changed)
+		p.changed = make(chan struct{})
+		p.mu.Unlock()
+		if err != nil {
+			// Linux reports EIO when all the slave
+			// file descriptors have been closed.
+			return
+		}
+	}
+}
+
+// Expect waits until the output that follows the previous match contains
+// a match for the given regular expression, and returns the match and
+// its submatches. Output up to the end of the match is consumed. It
+// fails the test if no match is found before the timeout or the end
+// of the output.
+func (p *PseudoTerminal) Expect(pattern string) []string {
+	re := regexp.MustCompile(pattern)
+	timeout := time.After(p.Timeout)
+	for {
+		p.mu.Lock()
+		loc := re.FindSubmatchIndex(p.output[p.pos:])
+		if loc != nil {
+			match := make([]string, len(loc)/2)
+			for i := range match {
+				if loc[2*i] >= 0 {
+					match[i] = string(p.output[p.pos+loc[2*i] : p.pos+loc[2*i+1]])
+				}
+			}
+			p.pos += loc[1]
+			p.mu.Unlock()
+			return match
+		}
+		changed := p.changed
+		p.mu.Unlock()
+		select {
+		case <-changed:
+		case <-p.readDone:
+			// Check the output for the last time, now
+			// that there will be no more.
+			p.mu.Lock()
+			loc := re.FindIndex(p.output[p.pos:])
+			p.mu.Unlock()
+			if loc == nil {
+				p.fatalf("terminal closed before output matching %q", pattern)
+			}
+		case <-timeout:
+			p.fatalf("timed out after %v waiting for output matching %q", p.Timeout, pattern)
+		}
+	}
+}
+
+// Send writes the given line to the terminal, followed by a newline,
+// as if it had been typed.
+func (p *PseudoTerminal) Send(line string) {
+	p.Write([]byte(line + "\n"))
+}
+
+// Write writes the given data to the terminal without
+// adding a newline. It can be used to send control
+// characters, such as "\x03" for an interrupt.
+func (p *PseudoTerminal) Write(data []byte) {
+	if _, err := p.master.Write(data); err != nil {
+		p.fatalf("cannot write to terminal: %v", err)
+	}
+}
+
+// Resize sets the window size of the terminal, which sends
+// SIGWINCH to the foreground process group of a command.
+func (p *PseudoTerminal) Resize(rows, cols int) {
+	ws := winsize{Row: uint16(rows), Col: uint16(cols)}
+	if err := ioctl(p.master, syscall.TIOCSWINSZ, uintptr(unsafe.Pointer(&ws))); err != nil {
+		p.fatalf("cannot resize terminal: %v", err)
+	}
+}
+
+// Wait waits for the command or function to finish and for all its
+// output to be read, and returns the error returned by exec.Cmd.Wait
+// or by the function. It fails the test if they have not finished
+// before the timeout.
+func (p *PseudoTerminal) Wait() error {
+	timeout := time.After(p.Timeout)
+	select {
+	case <-p.done:
+	case <-timeout:
+		p.fatalf("timed out after %v waiting for terminal process to finish", p.Timeout)
+	}
+	select {
+	case <-p.readDone:
+	case <-timeout:
+		p.fatalf("timed out after %v waiting for terminal to be closed", p.Timeout)
+	}
+	return p.err
+}
+
+// ExitCode waits as for Wait and returns the exit code of the
+// command, or 0 if it succeeded. It fails the test if the
+// command could not be run or was killed by a signal.
+func (p *PseudoTerminal) ExitCode() int {
+	err := p.Wait()
+	if err == nil {
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() == -1 {
+		p.fatalf("command did not exit normally: %v", err)
+	}
+	return exitErr.ExitCode()
+}
+
+// Transcript returns everything that has been written to the
+// terminal, including the echo of any input sent to it.
+func (p *PseudoTerminal) Transcript() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return string(p.output)
+}
+
+// Close kills the command if it is still running, and closes
+// the terminal.
+func (p *PseudoTerminal) Close() error {
+	if p.kill != nil {
+		select {
+		case <-p.done:
+		default:
+			p.kill()
+		}
+	}
+	return p.master.Close()
+}
+
+func (p *PseudoTerminal) fatalf(format string, args ...interface{}) {
+	p.c.Fatalf("%s\ntranscript:\n%s", fmt.Sprintf(format, args...), indentTranscript(p.Transcript()))
+}
+
+// indentTranscript indents each line of the transcript so that it
+// stands out from the surrounding output, and removes carriage
+// returns, which would otherwise hide parts of it.
+func indentTranscript(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	var buf strings.Builder
+	for _, line := range strings.SplitAfter(s, "\n") {
+		if line != "" {
+			buf.WriteString("    " + line)
+		}
+	}
+	return buf.String()
+}
+
+// winsize holds a terminal window size, as
+// used by the TIOCSWINSZ ioctl.
+type winsize struct {
+	Row    uint16
+	Col    uint16
+	Xpixel uint16
+	Ypixel uint16
+}
+
+// openPTY opens a new pseudo-terminal and returns its
+// master and slave sides.
+func openPTY() (master, slave *os.File, err error) {
+	master, err = os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		if err != nil {
+			master.Close()
+		}
+	}()
+	var unlock int32
+	if err := ioctl(master, syscall.TIOCSPTLCK, uintptr(unsafe.Pointer(&unlock))); err != nil {
+		return nil, nil, fmt.Errorf("cannot unlock pseudo-terminal: %v", err)
+	}
+	var n uint32
+	if err := ioctl(master, syscall.TIOCGPTN, uintptr(unsafe.Pointer(&n))); err != nil {
+		return nil, nil, fmt.Errorf("cannot get pseudo-terminal number: %v", err)
+	}
+	slave, err = os.OpenFile("/dev/pts/"+strconv.Itoa(int(n)), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	return master, slave, nil
+}
+
+// ioctl calls the ioctl system call on the file. It uses the raw
+// connection of the file rather than its Fd method, which would put
+// it into blocking mode and stop Close from interrupting reads.
+func ioctl(f *os.File, req, arg uintptr) error {
+	conn, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var errno syscall.Errno
+	err = conn.Control(func(fd uintptr) {
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, req, arg)
+	})
+	if err != nil {
+		return err
+	}
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package testing_test
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+)
+
+type ptySuite struct{}
+
+var _ = gc.Suite(&ptySuite{})
+
+// shellCommand returns a command that runs the given shell script.
+// It does not depend on $PATH, which other tests may have changed.
+func shellCommand(script string) *exec.Cmd {
+	cmd := exec.Command("/bin/sh", "-c", script)
+	cmd.Env = append(os.Environ(), "PATH=/usr/bin:/bin")
+	return cmd
+}
+
+func (*ptySuite) TestCommand(c *gc.C) {
+	cmd := shellCommand(`
+if [ -t 1 ]; then echo "stdout is a terminal"; fi
+printf "Name: "
+read name
+echo "Hello, $name"
+exit 3
+`)
+	p := testing.StartPTY(c, cmd)
+	defer p.Close()
+
+	p.Expect("stdout is a terminal")
+	p.Expect("Name: ")
+	p.Send("Gopher")
+	match := p.Expect(`Hello, (\w+)`)
+	c.Check(match, jc.DeepEquals, []string{"Hello, Gopher", "Gopher"})
+	c.Check(p.ExitCode(), gc.Equals, 3)
+}
+
+func (*ptySuite) TestResize(c *gc.C) {
+	p := testing.StartPTY(c, shellCommand("read x; stty size"))
+	defer p.Close()
+
+	p.Resize(33, 101)
+	p.Send("")
+	p.Expect(`33 101`)
+	c.Check(p.Wait(), jc.ErrorIsNil)
+}
+
+func (*ptySuite) TestFunc(c *gc.C) {
+	p := testing.StartPTYFunc(c, func(tty *os.File) error {
+		fmt.Fprint(tty, "Continue? [y/N] ")
+		answer, err := bufio.NewReader(tty).ReadString('\n')
+		if err != nil {
+			return err
+		}
+		if answer != "y\n" {
+			return fmt.Errorf("unexpected answer %q", answer)
+		}
+		return nil
+	})
+	defer p.Close()
+
+	p.Expect(`\[y/N\] `)
+	p.Send("y")
+	c.Check(p.Wait(), jc.ErrorIsNil)
+	c.Check(p.Transcript(), gc.Equals, "Continue? [y/N] y\r\n")
+}
+
+// expectFailSuite is run by TestExpectTimeout.
+type expectFailSuite struct{}
+
+func (*expectFailSuite) TestExpect(c *gc.C) {
+	p := testing.StartPTY(c, shellCommand("echo first line; sleep 10"))
+	defer p.Close()
+	p.Timeout = testing.ShortWait
+	p.Expect("first")
+	p.Expect("second")
+}
+
+func (*ptySuite) TestExpectTimeout(c *gc.C) {
+	var output bytes.Buffer
+	start := time.Now()
+	result := gc.Run(&expectFailSuite{}, &gc.RunConf{Output: &output})
+	c.Check(time.Since(start) < testing.LongWait, jc.IsTrue)
+	c.Check(result.Failed, gc.Equals, 1)
+	c.Check(output.String(), gc.Matches, `(?s).*`+
+		`timed out after 50ms waiting for output matching "second"\n`+
+		`transcript:\n`+
+		`    first line\n.*`)
+}
+
+func (*ptySuite) TestExpectAfterClose(c *gc.C) {
+	var output bytes.Buffer
+	result := gc.Run(&expectClosedSuite{}, &gc.RunConf{Output: &output})
+	c.Check(result.Failed, gc.Equals, 1)
+	c.Check(output.String(), gc.Matches, `(?s).*terminal closed before output matching "missing".*`)
+}
+
+// expectClosedSuite is run by TestExpectAfterClose.
+type expectClosedSuite struct{}
+
+func (*expectClosedSuite) TestExpect(c *gc.C) {
+	p := testing.StartPTY(c, shellCommand("exit 0"))
+	defer p.Close()
+	p.Expect("missing")
+}
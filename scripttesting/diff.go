@@ -0,0 +1,68 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package scripttesting
+
+import (
+	"strings"
+)
+
+// diffLines returns a line-by-line description of the changes needed
+// to turn want into got. Lines only in want are prefixed with "-",
+// lines only in got with "+", and lines in both with a space.
+func diffLines(want, got string) string {
+	a := splitLines(want)
+	b := splitLines(got)
+	// lcs[i][j] holds the length of the longest common
+	// subsequence of a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	var buf strings.Builder
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			buf.WriteString(" " + a[i] + "\n")
+			i++
+			j++
+		case j < len(b) && (i == len(a) || lcs[i][j+1] >= lcs[i+1][j]):
+			buf.WriteString("+" + b[j] + "\n")
+			j++
+		default:
+			buf.WriteString("-" + a[i] + "\n")
+			i++
+		}
+	}
+	return buf.String()
+}
+
+// splitLines splits s into lines, marking a missing final newline
+// so that it shows up in the diff.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	for i, line := range lines {
+		if strings.HasSuffix(line, "\n") {
+			lines[i] = strings.TrimSuffix(line, "\n")
+		} else {
+			lines[i] = line + " (no final newline)"
+		}
+	}
+	return lines
+}
@@ -0,0 +1,33 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package scripttesting
+
+import (
+	gc "gopkg.in/check.v1"
+
+	jc "github.com/juju/testing/checkers"
+)
+
+type internalSuite struct{}
+
+var _ = gc.Suite(&internalSuite{})
+
+func (*internalSuite) TestDiffLines(c *gc.C) {
+	c.Check(diffLines("a\nb\nc\n", "a\nc\nd"), gc.Equals, " a\n-b\n c\n+d (no final newline)\n")
+	c.Check(diffLines("", "x\n"), gc.Equals, "+x\n")
+}
+
+func (*internalSuite) TestSplitArgs(c *gc.C) {
+	s := &scriptState{env: map[string]string{"X": "ex"}}
+	words, err := s.splitArgs(`exec a$X 'b $X' 'it''s' ${X}c`, true)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(words, jc.DeepEquals, []string{"exec", "aex", "b $X", "it's", "exc"})
+
+	words, err = s.splitArgs(`stdout '^x$' $X`, false)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(words, jc.DeepEquals, []string{"stdout", "^x$", "$X"})
+
+	_, err = s.splitArgs(`exec 'oops`, true)
+	c.Check(err, gc.ErrorMatches, "unterminated quote")
+}
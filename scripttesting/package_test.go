@@ -0,0 +1,22 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package scripttesting_test
+
+import (
+	"os"
+	stdtesting "testing"
+
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/testing"
+)
+
+func TestMain(m *stdtesting.M) {
+	testing.RunExecHelperProcess()
+	os.Exit(m.Run())
+}
+
+func Test(t *stdtesting.T) {
+	gc.TestingT(t)
+}
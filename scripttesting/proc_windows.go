@@ -0,0 +1,18 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package scripttesting
+
+import (
+	"os/exec"
+)
+
+// setProcessGroup does nothing, as Windows
+// has no process groups to kill.
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// killProcessGroup kills the command itself;
+// any processes it started keep running.
+func killProcessGroup(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
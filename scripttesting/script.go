@@ -0,0 +1,595 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package scripttesting runs command line behaviour tests written as
+// script files in txtar format.
+//
+// The comment section of each script holds the commands to run, one
+// per line. Blank lines and lines starting with # are ignored. The files
+// in the archive are created in the script's work directory before it
+// runs. For example:
+//
+//	env GREETING=hello
+//	exec greet world
+//	cmp stdout want
+//	! exec greet
+//	status 2
+//	stderr 'usage: greet'
+//
+//	-- want --
+//	hello world
+//
+// Arguments are separated by spaces. Single-quoted text is taken
+// literally, with two single quotes standing for one; elsewhere $NAME and
+// ${NAME} are replaced by the value of the environment variable.
+//
+// The available commands are:
+//
+//	exec program [args...]
+//		Run the program, which must succeed. Its output is kept
+//		for the commands below. With a ! prefix, it must fail.
+//	status code
+//		Check the exit code of the last program run.
+//	stdout pattern
+//	stderr pattern
+//		Check that the output of the last program run matches the
+//		regular expression, which is in multi-line mode. With a !
+//		prefix, it must not match. The pattern is not expanded.
+//	cmp stdout file
+//	cmp stderr file
+//		Check that the output of the last program run is the same
+//		as the contents of the file. Differences are shown as a diff,
+//		and when updating scripts the file is rewritten instead.
+//	env name=value
+//		Set an environment variable for the programs that follow.
+//	cd dir
+//		Change the directory that programs are run in.
+//	stdin file
+//		Use the file as the standard input of the next program run.
+//	exists path...
+//		Check that the files exist. With a ! prefix, they must not.
+package scripttesting
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rogpeppe/go-internal/txtar"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	"github.com/juju/testing/filetesting"
+)
+
+var updateScripts = flag.Bool("scripttesting.update", false, "Rewrite the expected output in script files to match the actual output")
+
+// Params holds parameters for Run.
+type Params struct {
+	// Dir holds the directory containing the scripts. Each file in
+	// it with a .txtar suffix is run as a separate script.
+	Dir string
+
+	// Setup, if not nil, is called before each script runs, after
+	// its files have been created. It can patch executables into the
+	// sandbox by passing the sandbox as the patcher to functions such
+	// as testing.PatchFakeExecutable.
+	Setup func(c *gc.C, sb *Sandbox)
+
+	// UpdateScripts causes cmp commands that fail to rewrite the
+	// file in the script instead. It is also enabled by the
+	// -scripttesting.update flag.
+	UpdateScripts bool
+
+	// Timeout holds the time a program may run for before it is
+	// killed. It defaults to testing.LongWait.
+	Timeout time.Duration
+}
+
+// Sandbox holds the directories and environment that a script runs in.
+// The environment variables WORK, HOME and TMPDIR are set to the work,
+// home and temporary directories, and the bin directory is added to
+// the start of PATH. The environment is restored when the script
+// finishes.
+type Sandbox struct {
+	// WorkDir holds the directory that the files in the
+	// script are created in, and that programs are run in.
+	WorkDir string
+
+	// HomeDir holds the fake home directory.
+	HomeDir string
+
+	// BinDir holds a directory in the executable search path,
+	// which executables can be added to.
+	BinDir string
+
+	// TempDir holds the temporary directory.
+	TempDir string
+
+	restore testing.Restorer
+}
+
+var _ testing.EnvironmentPatcher = (*Sandbox)(nil)
+
+func newSandbox(c *gc.C) *Sandbox {
+	root := c.MkDir()
+	sb := &Sandbox{
+		WorkDir: filepath.Join(root, "work"),
+		HomeDir: filepath.Join(root, "home"),
+		BinDir:  filepath.Join(root, "bin"),
+		TempDir: filepath.Join(root, "tmp"),
+	}
+	for _, dir := range []string{sb.WorkDir, sb.HomeDir, sb.BinDir, sb.TempDir} {
+		err := os.Mkdir(dir, 0755)
+		c.Assert(err, jc.ErrorIsNil)
+	}
+	sb.PatchEnvironment("WORK", sb.WorkDir)
+	sb.PatchEnvironment("HOME", sb.HomeDir)
+	sb.PatchEnvironment("TMPDIR", sb.TempDir)
+	sb.PatchEnvironment("PATH", strings.Join([]string{sb.BinDir, os.Getenv("PATH")}, string(os.PathListSeparator)))
+	return sb
+}
+
+// PatchEnvironment sets the environment variable for the
+// duration of the script.
+func (sb *Sandbox) PatchEnvironment(name, value string) {
+	sb.restore = sb.restore.Add(testing.PatchEnvironment(name, value))
+}
+
+// Run runs each of the scripts in the directory given in the params,
+// failing the test if any of them fail. Each script runs in a new
+// sandbox. As the sandbox environment is inherited from the test, Run
+// is usually called from a suite that embeds testing.IsolationSuite.
+func Run(c *gc.C, params Params) {
+	if params.Timeout == 0 {
+		params.Timeout = testing.LongWait
+	}
+	params.UpdateScripts = params.UpdateScripts || *updateScripts
+	files, err := filepath.Glob(filepath.Join(params.Dir, "*.txtar"))
+	c.Assert(err, jc.ErrorIsNil)
+	if len(files) == 0 {
+		c.Fatalf("no scripts found in %q", params.Dir)
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		c.Logf("script %s", file)
+		runScript(c, params, file)
+	}
+}
+
+func runScript(c *gc.C, params Params, file string) {
+	data, err := os.ReadFile(file)
+	c.Assert(err, jc.ErrorIsNil)
+	a := txtar.Parse(data)
+
+	sb := newSandbox(c)
+	defer sb.restore()
+	fixtureEntries(a).Create(c, sb.WorkDir)
+	if params.Setup != nil {
+		params.Setup(c, sb)
+	}
+
+	s := &scriptState{
+		c:       c,
+		params:  params,
+		sandbox: sb,
+		archive: a,
+		dir:     sb.WorkDir,
+		env:     make(map[string]string),
+	}
+	for i, line := range strings.Split(string(a.Comment), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		c.Logf("> %s", line)
+		if err := s.run(line); err != nil {
+			c.Errorf("%s:%d: %s\n%v", file, i+1, line, err)
+			break
+		}
+	}
+	if s.updated {
+		err := os.WriteFile(file, txtar.Format(a), 0644)
+		c.Assert(err, jc.ErrorIsNil)
+		c.Logf("updated %s", file)
+	}
+}
+
+// fixtureEntries returns the entries that create the files in the
+// archive, along with the directories that contain them.
+func fixtureEntries(a *txtar.Archive) filetesting.Entries {
+	var entries filetesting.Entries
+	dirs := make(map[string]bool)
+	for _, f := range a.Files {
+		name := path.Clean(f.Name)
+		if dir := path.Dir(name); dir != "." && !dirs[dir] {
+			dirs[dir] = true
+			entries = append(entries, filetesting.Dir{Path: dir, Perm: 0755})
+		}
+		entries = append(entries, filetesting.File{Path: name, Data: string(f.Data), Perm: 0644})
+	}
+	return entries
+}
+
+// scriptState holds the state of a running script.
+type scriptState struct {
+	c       *gc.C
+	params  Params
+	sandbox *Sandbox
+	archive *txtar.Archive
+
+	// dir holds the directory programs are run in.
+	dir string
+	// env holds the environment variables set by the script.
+	env map[string]string
+	// stdin holds the name of the file to use as the
+	// standard input of the next program, if any.
+	stdin string
+
+	// stdout, stderr and status hold the results
+	// of the last program run.
+	stdout string
+	stderr string
+	status int
+
+	// updated records whether any files in the
+	// archive have been updated.
+	updated bool
+}
+
+// run runs a single line of the script.
+func (s *scriptState) run(line string) error {
+	words, err := s.splitArgs(line, false)
+	if err != nil {
+		return err
+	}
+	negate := false
+	if words[0] == "!" {
+		negate = true
+		words = words[1:]
+		if len(words) == 0 {
+			return fmt.Errorf("missing command after !")
+		}
+	}
+	if name := words[0]; name != "stdout" && name != "stderr" {
+		// Expand environment variables in all the
+		// arguments other than regular expressions.
+		words, err = s.splitArgs(line, true)
+		if err != nil {
+			return err
+		}
+		if negate {
+			words = words[1:]
+		}
+	}
+	name, args := words[0], words[1:]
+	switch name {
+	case "exec":
+		return s.exec(negate, args)
+	case "exists":
+		return s.exists(negate, args)
+	case "stdout":
+		return s.match(negate, args, "stdout", s.stdout)
+	case "stderr":
+		return s.match(negate, args, "stderr", s.stderr)
+	}
+	if negate {
+		return fmt.Errorf("%s does not support !", name)
+	}
+	switch name {
+	case "status":
+		return s.checkStatus(args)
+	case "cmp":
+		return s.cmp(args)
+	case "env":
+		return s.setenv(args)
+	case "cd":
+		return s.cd(args)
+	case "stdin":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: stdin file")
+		}
+		s.stdin = args[0]
+		return nil
+	}
+	return fmt.Errorf("unknown command %q", name)
+}
+
+func (s *scriptState) exec(negate bool, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: exec program [args...]")
+	}
+	path, err := s.lookPath(args[0])
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.params.Timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, path, args[1:]...)
+	// Run the program in its own process group, so that
+	// any processes it starts are killed along with it if
+	// it times out, and give up waiting for them to close
+	// its output shortly after that.
+	setProcessGroup(cmd)
+	cmd.Cancel = func() error {
+		return killProcessGroup(cmd)
+	}
+	cmd.WaitDelay = time.Second
+	cmd.Dir = s.dir
+	cmd.Env = s.environ()
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if s.stdin != "" {
+		f, err := os.Open(s.path(s.stdin))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		cmd.Stdin = f
+		s.stdin = ""
+	}
+	err = cmd.Run()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("program still running after %v", s.params.Timeout)
+	}
+	s.stdout, s.stderr = stdout.String(), stderr.String()
+	if s.stdout != "" {
+		s.c.Logf("[stdout]\n%s", strings.TrimSuffix(s.stdout, "\n"))
+	}
+	if s.stderr != "" {
+		s.c.Logf("[stderr]\n%s", strings.TrimSuffix(s.stderr, "\n"))
+	}
+	s.status = 0
+	if err != nil {
+		exitErr, ok := err.(*exec.ExitError)
+		if !ok {
+			return err
+		}
+		s.status = exitErr.ExitCode()
+		s.c.Logf("[%v]", err)
+	}
+	switch {
+	case negate && s.status == 0:
+		return fmt.Errorf("unexpected success")
+	case !negate && s.status != 0:
+		return fmt.Errorf("unexpected exit status %d", s.status)
+	}
+	return nil
+}
+
+func (s *scriptState) checkStatus(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: status code")
+	}
+	want, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid exit code %q", args[0])
+	}
+	if s.status != want {
+		return fmt.Errorf("exit status is %d, not %d", s.status, want)
+	}
+	return nil
+}
+
+func (s *scriptState) match(negate bool, args []string, stream, output string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: %s pattern", stream)
+	}
+	re, err := regexp.Compile("(?m)" + args[0])
+	if err != nil {
+		return err
+	}
+	switch {
+	case negate && re.MatchString(output):
+		return fmt.Errorf("%s unexpectedly matches %q:\n%s", stream, args[0], output)
+	case !negate && !re.MatchString(output):
+		return fmt.Errorf("%s does not match %q:\n%s", stream, args[0], output)
+	}
+	return nil
+}
+
+func (s *scriptState) cmp(args []string) error {
+	if len(args) != 2 || (args[0] != "stdout" && args[0] != "stderr") {
+		return fmt.Errorf("usage: cmp stdout|stderr file")
+	}
+	got := s.stdout
+	if args[0] == "stderr" {
+		got = s.stderr
+	}
+	want, err := os.ReadFile(s.path(args[1]))
+	if err != nil {
+		return err
+	}
+	if string(want) == got {
+		return nil
+	}
+	if s.params.UpdateScripts && s.updateFile(args[1], got) {
+		return nil
+	}
+	return fmt.Errorf("%s and %s differ:\n%s", args[0], args[1], diffLines(string(want), got))
+}
+
+// updateFile replaces the contents of the named archive file,
+// reporting whether the file was found in the archive.
+func (s *scriptState) updateFile(name, data string) bool {
+	rel, err := filepath.Rel(s.sandbox.WorkDir, s.path(name))
+	if err != nil {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	for i, f := range s.archive.Files {
+		if path.Clean(f.Name) == rel {
+			s.archive.Files[i].Data = []byte(data)
+			s.updated = true
+			return true
+		}
+	}
+	return false
+}
+
+func (s *scriptState) setenv(args []string) error {
+	for _, arg := range args {
+		name, value, ok := strings.Cut(arg, "=")
+		if !ok || name == "" {
+			return fmt.Errorf("usage: env name=value...")
+		}
+		s.env[name] = value
+	}
+	return nil
+}
+
+func (s *scriptState) cd(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: cd dir")
+	}
+	dir := s.path(args[0])
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", args[0])
+	}
+	s.dir = dir
+	return nil
+}
+
+func (s *scriptState) exists(negate bool, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: exists path...")
+	}
+	for _, arg := range args {
+		_, err := os.Lstat(s.path(arg))
+		switch {
+		case negate && err == nil:
+			return fmt.Errorf("%s unexpectedly exists", arg)
+		case !negate && err != nil:
+			return err
+		}
+	}
+	return nil
+}
+
+// path returns the path of the named file
+// relative to the current directory.
+func (s *scriptState) path(name string) string {
+	name = filepath.FromSlash(name)
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(s.dir, name)
+}
+
+// getenv returns the value of the environment variable
+// that programs run by the script will see.
+func (s *scriptState) getenv(name string) string {
+	if value, ok := s.env[name]; ok {
+		return value
+	}
+	return os.Getenv(name)
+}
+
+// environ returns the environment for programs run by the script.
+func (s *scriptState) environ() []string {
+	env := os.Environ()
+	names := make([]string, 0, len(s.env))
+	for name := range s.env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		env = append(env, name+"="+s.env[name])
+	}
+	return env
+}
+
+// lookPath finds the named program using the
+// script's PATH environment variable.
+func (s *scriptState) lookPath(name string) (string, error) {
+	if strings.ContainsAny(name, `/\`) {
+		return exec.LookPath(s.path(name))
+	}
+	for _, dir := range filepath.SplitList(s.getenv("PATH")) {
+		if dir == "" {
+			continue
+		}
+		if path, err := exec.LookPath(filepath.Join(dir, name)); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("program %q not found in $PATH", name)
+}
+
+// splitArgs splits a script line into words. If expand is true,
+// environment variables outside single quotes are expanded.
+func (s *scriptState) splitArgs(line string, expand bool) ([]string, error) {
+	var (
+		words  []string
+		word   strings.Builder
+		inWord bool
+	)
+	expandText := func(text string) string {
+		if expand {
+			return os.Expand(text, s.getenv)
+		}
+		return text
+	}
+	for i := 0; i < len(line); {
+		switch ch := line[i]; {
+		case ch == ' ' || ch == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+			i++
+		case ch == '\'':
+			inWord = true
+			i++
+			for {
+				end := strings.IndexByte(line[i:], '\'')
+				if end == -1 {
+					return nil, fmt.Errorf("unterminated quote")
+				}
+				word.WriteString(line[i : i+end])
+				i += end + 1
+				if i < len(line) && line[i] == '\'' {
+					// A doubled quote stands for a
+					// single quote inside the quotes.
+					word.WriteByte('\'')
+					i++
+					continue
+				}
+				break
+			}
+		default:
+			inWord = true
+			end := strings.IndexAny(line[i:], " \t'")
+			if end == -1 {
+				end = len(line) - i
+			}
+			word.WriteString(expandText(line[i : i+end]))
+			i += end
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	if len(words) == 0 {
+		return nil, fmt.Errorf("empty command")
+	}
+	return words, nil
+}
@@ -0,0 +1,160 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package scripttesting_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	"github.com/juju/testing/scripttesting"
+)
+
+type scriptSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&scriptSuite{})
+
+func (s *scriptSuite) TestRun(c *gc.C) {
+	var (
+		greet *testing.FakeExecutable
+		sb    *scripttesting.Sandbox
+	)
+	scripttesting.Run(c, scripttesting.Params{
+		Dir: "testdata",
+		Setup: func(c *gc.C, sandbox *scripttesting.Sandbox) {
+			sb = sandbox
+			greet = testing.PatchFakeExecutable(c, sb, "greet",
+				testing.FakeExecResponse{Stdout: "hello world\n"},
+				testing.FakeExecResponse{Stderr: "usage: greet\n", ExitCode: 2},
+				testing.FakeExecResponse{Stdout: "hello world\n", ReadStdin: true},
+			)
+		},
+	})
+	c.Assert(greet, gc.NotNil)
+
+	calls := greet.Calls(c)
+	c.Assert(calls, gc.HasLen, 3)
+	c.Check(calls[0].Args, jc.DeepEquals, []string{"hello", "big world"})
+	c.Check(calls[0].Getenv("GREETING"), gc.Equals, "hello")
+	c.Check(calls[0].Getenv("HOME"), gc.Equals, sb.HomeDir)
+	c.Check(calls[0].Dir, gc.Equals, sb.WorkDir)
+	c.Check(calls[2].Dir, gc.Equals, filepath.Join(sb.WorkDir, "dir"))
+	c.Check(calls[2].Stdin, gc.Equals, "contents\n")
+
+	// The sandbox environment is restored after the script.
+	c.Check(os.Getenv("WORK"), gc.Equals, "")
+}
+
+// failingScriptSuite is run by TestRunFailure and TestRunUpdate.
+type failingScriptSuite struct {
+	testing.IsolationSuite
+	dir    string
+	update bool
+}
+
+func (s *failingScriptSuite) TestScript(c *gc.C) {
+	scripttesting.Run(c, scripttesting.Params{
+		Dir:           s.dir,
+		UpdateScripts: s.update,
+		Setup: func(c *gc.C, sb *scripttesting.Sandbox) {
+			testing.PatchFakeExecutable(c, sb, "list",
+				testing.FakeExecResponse{Stdout: "one\nthree\nfour\n"},
+			)
+		},
+	})
+}
+
+const failingScript = `exec list
+cmp stdout want
+stdout never-reached
+
+-- want --
+one
+two
+three
+`
+
+func (s *scriptSuite) TestRunFailure(c *gc.C) {
+	dir := c.MkDir()
+	err := os.WriteFile(filepath.Join(dir, "list.txtar"), []byte(failingScript), 0644)
+	c.Assert(err, jc.ErrorIsNil)
+
+	var output bytes.Buffer
+	result := gc.Run(&failingScriptSuite{dir: dir}, &gc.RunConf{Output: &output})
+	c.Check(result.Failed, gc.Equals, 1)
+	c.Check(output.String(), gc.Matches, `(?s).*`+
+		`list.txtar:2: cmp stdout want\n`+
+		`stdout and want differ:\n`+
+		` one\n`+
+		`-two\n`+
+		` three\n`+
+		`\+four\n.*`)
+	c.Check(output.String(), gc.Not(gc.Matches), `(?s).*> stdout never-reached.*`)
+}
+
+func (s *scriptSuite) TestRunUpdate(c *gc.C) {
+	dir := c.MkDir()
+	file := filepath.Join(dir, "list.txtar")
+	err := os.WriteFile(file, []byte(failingScript), 0644)
+	c.Assert(err, jc.ErrorIsNil)
+
+	var output bytes.Buffer
+	result := gc.Run(&failingScriptSuite{dir: dir, update: true}, &gc.RunConf{Output: &output})
+	// The update fixes the comparison, but the
+	// script still fails at the following line.
+	c.Check(result.Failed, gc.Equals, 1)
+	c.Check(output.String(), gc.Matches, `(?s).*list.txtar:3: stdout never-reached\n.*`)
+
+	data, err := os.ReadFile(file)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(data), gc.Equals, `exec list
+cmp stdout want
+stdout never-reached
+
+-- want --
+one
+three
+four
+`)
+}
+
+// timeoutScriptSuite is run by TestRunTimeout.
+type timeoutScriptSuite struct {
+	testing.IsolationSuite
+	dir string
+}
+
+func (s *timeoutScriptSuite) TestScript(c *gc.C) {
+	scripttesting.Run(c, scripttesting.Params{
+		Dir:     s.dir,
+		Timeout: testing.ShortWait,
+	})
+}
+
+func (s *scriptSuite) TestRunTimeout(c *gc.C) {
+	if runtime.GOOS == "windows" {
+		c.Skip("test relies on sh")
+	}
+	// The program that times out has started another process
+	// that keeps its output open, which is killed with it.
+	dir := c.MkDir()
+	script := "env PATH=/usr/bin:/bin\nexec /bin/sh -c 'sleep 30 & wait'\n"
+	err := os.WriteFile(filepath.Join(dir, "sleep.txtar"), []byte(script), 0644)
+	c.Assert(err, jc.ErrorIsNil)
+
+	var output bytes.Buffer
+	start := time.Now()
+	result := gc.Run(&timeoutScriptSuite{dir: dir}, &gc.RunConf{Output: &output})
+	c.Check(time.Since(start) < testing.LongWait, jc.IsTrue)
+	c.Check(result.Failed, gc.Equals, 1)
+	c.Check(output.String(), gc.Matches, `(?s).*sleep.txtar:2: exec .*\nprogram still running after 50ms\n.*`)
+}
@@ -0,0 +1,131 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package testing
+
+import (
+	"context"
+	"io"
+	"log"
+	"log/slog"
+
+	"github.com/juju/loggo/v2"
+
+	jc "github.com/juju/testing/checkers"
+)
+
+// slogHandler is an slog.Handler that converts records to loggo
+// entries and writes them to a loggo writer, so that LoggingSuite
+// treats slog output in the same way as loggo output. Records are
+// enabled according to the level configured for the "slog" loggo
+// module.
+type slogHandler struct {
+	writer loggo.Writer
+	// goas holds the groups and attributes added with
+	// WithGroup and WithAttrs, outermost first.
+	goas []groupOrAttrs
+}
+
+// groupOrAttrs holds either a group name or a list of attributes.
+type groupOrAttrs struct {
+	group string
+	attrs []slog.Attr
+}
+
+// Enabled implements slog.Handler.
+func (h *slogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return loggo.GetLogger(jc.SlogModule).IsLevelEnabled(jc.LevelFromSlog(level))
+}
+
+// Handle implements slog.Handler.
+func (h *slogHandler) Handle(_ context.Context, r slog.Record) error {
+	attrs := make([]slog.Attr, 0, r.NumAttrs())
+	r.Attrs(func(attr slog.Attr) bool {
+		attrs = append(attrs, attr)
+		return true
+	})
+	// Nest the attributes of the record inside the groups
+	// and after the attributes of the handler, working out
+	// from the innermost group.
+	for i := len(h.goas) - 1; i >= 0; i-- {
+		goa := h.goas[i]
+		if goa.group == "" {
+			attrs = append(append([]slog.Attr(nil), goa.attrs...), attrs...)
+		} else if len(attrs) > 0 {
+			attrs = []slog.Attr{slog.Group(goa.group, attrsToAny(attrs)...)}
+		}
+	}
+	record := slog.NewRecord(r.Time, r.Level, r.Message, r.PC)
+	record.AddAttrs(attrs...)
+	h.writer.Write(jc.LogEntryFromSlog(record))
+	return nil
+}
+
+// WithAttrs implements slog.Handler.
+func (h *slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	return h.with(groupOrAttrs{attrs: attrs})
+}
+
+// WithGroup implements slog.Handler.
+func (h *slogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return h.with(groupOrAttrs{group: name})
+}
+
+func (h *slogHandler) with(goa groupOrAttrs) *slogHandler {
+	goas := make([]groupOrAttrs, len(h.goas), len(h.goas)+1)
+	copy(goas, h.goas)
+	return &slogHandler{
+		writer: h.writer,
+		goas:   append(goas, goa),
+	}
+}
+
+func attrsToAny(attrs []slog.Attr) []any {
+	args := make([]any, len(attrs))
+	for i, attr := range attrs {
+		args[i] = attr
+	}
+	return args
+}
+
+// slogState holds the global logging state that is changed
+// by installing an slog handler as the default.
+type slogState struct {
+	logger    *slog.Logger
+	logOutput io.Writer
+	logFlags  int
+}
+
+// installSlogHandler makes the default slog logger write to the
+// given writer, and returns the state needed to restore the
+// previous default.
+func installSlogHandler(writer loggo.Writer) *slogState {
+	// As well as replacing the default logger, slog.SetDefault
+	// redirects the output of the log package, which it does
+	// not undo when the previous default is restored, so we
+	// must save that too.
+	state := &slogState{
+		logger:    slog.Default(),
+		logOutput: log.Writer(),
+		logFlags:  log.Flags(),
+	}
+	slog.SetDefault(slog.New(&slogHandler{writer: writer}))
+	return state
+}
+
+// restore restores the state saved by installSlogHandler.
+// It does nothing if state is nil.
+func (state *slogState) restore() {
+	if state == nil {
+		return
+	}
+	slog.SetDefault(state.logger)
+	log.SetOutput(state.logOutput)
+	log.SetFlags(state.logFlags)
+}
@@ -0,0 +1,84 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package testing
+
+import (
+	"context"
+	"log"
+	"log/slog"
+
+	"github.com/juju/loggo/v2"
+	gc "gopkg.in/check.v1"
+
+	jc "github.com/juju/testing/checkers"
+)
+
+type slogSuite struct{}
+
+var _ = gc.Suite(&slogSuite{})
+
+func (*slogSuite) TestSlogToLoggingSuite(c *gc.C) {
+	origLogger := slog.Default()
+	origOutput := log.Writer()
+
+	var suite LoggingSuite
+	suite.SetUpTest(c)
+	defer suite.TearDownSuite(c)
+	loggo.GetLogger(jc.SlogModule).SetLogLevel(loggo.DEBUG)
+
+	slog.Info("hello", "key", "value")
+	slog.With("a", 1).WithGroup("g").Debug("grouped", "x", 2)
+	slog.Log(context.Background(), slog.LevelDebug-4, "too verbose")
+	log.Printf("from log")
+
+	suite.CheckLog(c,
+		jc.SimpleMessage{Level: loggo.INFO, Message: "hello"},
+		jc.SimpleMessage{Level: loggo.DEBUG, Message: "grouped"},
+		jc.SimpleMessage{Level: loggo.INFO, Message: "from log"},
+	)
+	c.Check(suite.LogEntries(), jc.LogMatches, []jc.LogMatch{{
+		Module: jc.SlogModule,
+		Labels: map[string]string{"key": "value"},
+	}, {
+		Labels:   map[string]string{"a": "1", "g.x": "2"},
+		Location: `slog_test\.go:\d+`,
+	}})
+	c.Check(suite.LogEntries(), gc.HasLen, 3)
+	c.Check(c.GetTestLog(), gc.Matches, "(?s).*INFO slog hello\n.*")
+
+	suite.TearDownTest(c)
+	c.Check(slog.Default(), gc.Equals, origLogger)
+	c.Check(log.Writer(), gc.Equals, origOutput)
+}
+
+func (*slogSuite) TestTearDownSuiteRestoresSlog(c *gc.C) {
+	origLogger := slog.Default()
+	var suite LoggingSuite
+	suite.SetUpSuite(c)
+	suite.SetUpTest(c)
+	c.Check(slog.Default(), gc.Not(gc.Equals), origLogger)
+	suite.TearDownSuite(c)
+	c.Check(slog.Default(), gc.Equals, origLogger)
+}
+
+func (*slogSuite) TestWithAttrsDoesNotShareState(c *gc.C) {
+	var suite LoggingSuite
+	suite.SetUpTest(c)
+	defer suite.TearDownSuite(c)
+	defer suite.TearDownTest(c)
+
+	base := slog.Default().WithGroup("g")
+	l1 := base.With("one", 1)
+	l2 := base.With("two", 2)
+	l1.Warn("first")
+	l2.Warn("second")
+	c.Check(suite.LogEntries(), jc.LogMatches, jc.LogExpectation{
+		Mode: jc.LogMatchExact,
+		Matches: []jc.LogMatch{
+			{Labels: map[string]string{"g.one": "1"}},
+			{Labels: map[string]string{"g.two": "2"}},
+		},
+	})
+	c.Check(suite.LogEntries()[1].Labels, gc.HasLen, 1)
+}
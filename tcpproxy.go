@@ -4,20 +4,36 @@
 package testing
 
 import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
 	"io"
+	"math/rand"
 	"net"
+	"path/filepath"
 	"sync"
+	"time"
 
 	jc "github.com/juju/testing/checkers"
 	gc "gopkg.in/check.v1"
 )
 
 // TCPProxy is a simple TCP proxy that can be used
-// to deliberately break TCP connections.
+// to deliberately break TCP connections. It can also
+// proxy connections to and from Unix domain sockets.
 type TCPProxy struct {
-	listener net.Listener
+	network       string
+	addr          string
+	remoteNetwork string
+	onError       func(error)
 	// mu guards the fields below it.
 	mu sync.Mutex
+	// listener holds the current listener of the proxy.
+	listener net.Listener
+	// remoteAddr holds the address that new connections are made to.
+	remoteAddr string
+	// refuse holds whether new connections are refused.
+	refuse bool
 	// stopStart holds a condition variable that broadcasts changes
 	// in the paused state.
 	stopStart sync.Cond
@@ -25,52 +41,389 @@ type TCPProxy struct {
 	closed bool
 	// paused holds whether the proxy has been paused.
 	paused bool
-	// conns holds all connections that have been made.
-	conns []io.Closer
+	// dirPaused holds whether each direction has been paused.
+	dirPaused [2]bool
+	// conns holds the connections that are currently active.
+	conns []*TCPProxyConn
+	// connected holds the number of connections that
+	// have been made through the proxy.
+	connected int
+	// accepted holds the number of clients that have been accepted.
+	accepted int
+	// failed holds the number of clients whose connection
+	// to the remote address could not be made.
+	failed int
+	// refused holds the number of clients that were refused.
+	refused int
+	// connChanged is closed and replaced when a
+	// connection is made through the proxy.
+	connChanged chan struct{}
+	// links holds the conditions of the simulated
+	// link in each direction.
+	links [2]LinkConditions
+	// record holds whether traffic is being recorded.
+	record bool
+	// chunkHook holds the hook set by SetChunkHook.
+	chunkHook ChunkHook
+}
+
+// ChunkHook is called by a TCPProxy with each chunk of data that is
+// about to be sent through the given connection in the given
+// direction. It returns the data to send in place of the chunk,
+// so it can observe the chunk, rewrite it, or inject data before
+// or after it. If it returns no data, nothing is sent.
+//
+// Chunks are read from the connection as the data arrives, and
+// may be split further to simulate a limited bandwidth, so a hook
+// should not rely on a chunk holding a whole protocol message.
+type ChunkHook func(conn *TCPProxyConn, dir Direction, data []byte) []byte
+
+// TrafficChunk holds a chunk of data that was
+// sent through a connection made through a TCPProxy.
+type TrafficChunk struct {
+	// Time holds the time the chunk was sent.
+	Time time.Time
+
+	// Data holds the data that was sent.
+	Data []byte
+}
+
+// Traffic holds the chunks of data that were sent
+// through a connection in one direction.
+type Traffic []TrafficChunk
+
+// Bytes returns all the data that was sent.
+func (t Traffic) Bytes() []byte {
+	var data []byte
+	for _, chunk := range t {
+		data = append(data, chunk.Data...)
+	}
+	return data
+}
+
+// Reader returns a reader that reads all the data that was sent.
+func (t Traffic) Reader() io.Reader {
+	return bytes.NewReader(t.Bytes())
+}
+
+// String returns a printable dump of the traffic, holding one
+// line for each chunk with the chunk quoted as a Go string.
+// Each line starts with the time since the first chunk.
+func (t Traffic) String() string {
+	var buf bytes.Buffer
+	for _, chunk := range t {
+		fmt.Fprintf(&buf, "+%v %q\n", chunk.Time.Sub(t[0].Time), chunk.Data)
+	}
+	return buf.String()
+}
+
+// HexDump returns a hex dump of each chunk of the traffic,
+// as for encoding/hex.Dump, following a line that holds the
+// time since the first chunk and the size of the chunk.
+func (t Traffic) HexDump() string {
+	var buf bytes.Buffer
+	for _, chunk := range t {
+		fmt.Fprintf(&buf, "+%v %d bytes\n", chunk.Time.Sub(t[0].Time), len(chunk.Data))
+		buf.WriteString(hex.Dump(chunk.Data))
+	}
+	return buf.String()
+}
+
+// Direction identifies the direction in which
+// data flows through a TCPProxy.
+type Direction int
+
+const (
+	// ClientToServer is the direction of data written by a
+	// client of the proxy to the remote address.
+	ClientToServer Direction = iota
+
+	// ServerToClient is the direction of data written by the
+	// remote address to a client of the proxy.
+	ServerToClient
+)
+
+// String returns the name of the direction.
+func (d Direction) String() string {
+	switch d {
+	case ClientToServer:
+		return "client to server"
+	case ServerToClient:
+		return "server to client"
+	}
+	return "unknown direction"
+}
+
+// LinkConditions describes the simulated network link
+// that data flowing through a TCPProxy in one direction
+// travels over.
+type LinkConditions struct {
+	// Latency holds the time that data takes to cross the link.
+	Latency time.Duration
+
+	// Jitter holds the maximum random time that is added
+	// to Latency for each chunk of data. Data is never
+	// reordered, so a chunk is never delivered before
+	// the chunk that preceded it.
+	Jitter time.Duration
+
+	// Bandwidth holds the maximum number of bytes per second
+	// that can cross the link. If it is zero, the bandwidth
+	// is unlimited.
+	Bandwidth int
+}
+
+// TCPProxyConfig holds the configuration of a TCPProxy
+// started with StartTCPProxy.
+type TCPProxyConfig struct {
+	// RemoteAddr holds the address that the proxy
+	// copies to and from.
+	RemoteAddr string
+
+	// RemoteNetwork holds the network of RemoteAddr,
+	// either "tcp" or "unix". If it is empty, "tcp" is used.
+	RemoteNetwork string
+
+	// Network holds the network that the proxy listens on,
+	// either "tcp" or "unix". If it is empty, "tcp" is used.
+	Network string
+
+	// Addr holds the address that the proxy listens on. If it is
+	// empty and Network is "tcp", a new address on 127.0.0.1 is
+	// used. It must be set if Network is "unix".
+	Addr string
+
+	// OnError, if not nil, is called with any error encountered
+	// by the proxy after it has started, such as a failure to dial
+	// the remote address. It is called from the goroutine that
+	// accepts connections, so it should not block.
+	OnError func(error)
+}
+
+// TCPProxyStats holds counts of the connections
+// made through a TCPProxy.
+type TCPProxyStats struct {
+	// Accepted holds the number of clients
+	// that the proxy has accepted.
+	Accepted int
+
+	// Failed holds the number of accepted clients that were
+	// disconnected because the remote address could not be dialed.
+	Failed int
+
+	// Refused holds the number of accepted clients that were
+	// reset because the proxy was refusing connections.
+	Refused int
+
+	// Active holds the number of connections
+	// through the proxy that are currently active.
+	Active int
 }
 
 // NewTCPProxy runs a proxy that copies to and from
 // the given remote TCP address. When the proxy
 // is closed, its listener and all connections will be closed.
+// Any error encountered by the proxy is reported as a test error.
+// Tests that may finish while the proxy is still running should
+// use StartTCPProxy instead.
 func NewTCPProxy(c *gc.C, remoteAddr string) *TCPProxy {
-	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	p, err := StartTCPProxy(TCPProxyConfig{
+		RemoteAddr: remoteAddr,
+		OnError: func(err error) {
+			c.Errorf("%v", err)
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	return p
+}
+
+// NewUnixProxy runs a proxy that copies to and from the Unix domain
+// socket with the given path, and listens on a new Unix domain socket
+// in a directory created with c.MkDir. It is otherwise as for
+// NewTCPProxy.
+func NewUnixProxy(c *gc.C, remotePath string) *TCPProxy {
+	return newStreamProxy(c, "unix", filepath.Join(c.MkDir(), "proxy.sock"), "unix", remotePath)
+}
+
+// NewTCPToUnixProxy runs a proxy that listens on a new TCP address
+// on 127.0.0.1 and copies to and from the Unix domain socket with
+// the given path. It is otherwise as for NewTCPProxy.
+func NewTCPToUnixProxy(c *gc.C, remotePath string) *TCPProxy {
+	return newStreamProxy(c, "tcp", "", "unix", remotePath)
+}
+
+func newStreamProxy(c *gc.C, network, addr, remoteNetwork, remoteAddr string) *TCPProxy {
+	p, err := StartTCPProxy(TCPProxyConfig{
+		RemoteAddr:    remoteAddr,
+		RemoteNetwork: remoteNetwork,
+		Network:       network,
+		Addr:          addr,
+		OnError: func(err error) {
+			c.Errorf("%v", err)
+		},
+	})
 	c.Assert(err, jc.ErrorIsNil)
+	return p
+}
+
+// StartTCPProxy starts a proxy with the given configuration.
+// When the proxy is closed, its listener and all connections
+// will be closed.
+//
+// If the remote address cannot be dialed when a client connects,
+// the connection from that client is closed and the proxy continues
+// to accept other clients.
+func StartTCPProxy(config TCPProxyConfig) (*TCPProxy, error) {
+	network := config.Network
+	if network == "" {
+		network = "tcp"
+	}
+	remoteNetwork := config.RemoteNetwork
+	if remoteNetwork == "" {
+		remoteNetwork = "tcp"
+	}
+	addr := config.Addr
+	if addr == "" {
+		if network != "tcp" {
+			return nil, fmt.Errorf("no address specified for %s proxy", network)
+		}
+		// Note: Addr only works because we explicitly listen
+		// on 127.0.0.1 rather than the wildcard address.
+		addr = "127.0.0.1:0"
+	}
+	listener, err := net.Listen(network, addr)
+	if err != nil {
+		return nil, err
+	}
 	p := &TCPProxy{
-		listener: listener,
+		network:       network,
+		addr:          listener.Addr().String(),
+		remoteNetwork: remoteNetwork,
+		onError:       config.OnError,
+		listener:      listener,
+		remoteAddr:    config.RemoteAddr,
+		connChanged:   make(chan struct{}),
 	}
 	p.stopStart.L = &p.mu
-	go func() {
-		for {
-			client, err := p.listener.Accept()
-			if err != nil {
-				if !p.isClosed() {
-					c.Errorf("cannot accept: %v", err)
-				}
-				return
+	go p.accept(listener)
+	return p, nil
+}
+
+// accept accepts clients from the given listener until it is closed.
+func (p *TCPProxy) accept(listener net.Listener) {
+	for {
+		client, err := listener.Accept()
+		if err != nil {
+			if !p.isStopped(listener) {
+				p.reportError(fmt.Errorf("cannot accept: %w", err))
 			}
-			p.addConn(client)
-			server, err := net.Dial("tcp", remoteAddr)
-			if err != nil {
-				if !p.isClosed() {
-					c.Errorf("cannot dial remote address: %v", err)
-				}
-				return
+			return
+		}
+		p.mu.Lock()
+		p.accepted++
+		remoteAddr, refuse := p.remoteAddr, p.refuse
+		if refuse {
+			p.refused++
+		}
+		p.mu.Unlock()
+		if refuse {
+			resetConn(client)
+			continue
+		}
+		server, err := net.Dial(p.remoteNetwork, remoteAddr)
+		if err != nil {
+			client.Close()
+			p.mu.Lock()
+			p.failed++
+			p.mu.Unlock()
+			if !p.isStopped(listener) {
+				p.reportError(fmt.Errorf("cannot dial remote address: %w", err))
 			}
-			p.addConn(server)
-			go p.stream(client, server)
-			go p.stream(server, client)
+			continue
 		}
-	}()
-	return p
+		pc := newTCPProxyConn(p, client, server)
+		if !p.addConn(pc) {
+			continue
+		}
+		go p.stream(pc, ClientToServer)
+		go p.stream(pc, ServerToClient)
+	}
 }
 
-func (p *TCPProxy) addConn(c net.Conn) {
+func (p *TCPProxy) reportError(err error) {
+	if p.onError != nil {
+		p.onError(err)
+	}
+}
+
+// Stats returns counts of the connections made through the proxy.
+func (p *TCPProxy) Stats() TCPProxyStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return TCPProxyStats{
+		Accepted: p.accepted,
+		Failed:   p.failed,
+		Refused:  p.refused,
+		Active:   len(p.conns),
+	}
+}
+
+// addConn adds the connection to the proxy, reporting whether
+// it was added. If the proxy is closed, the connection is
+// closed instead.
+func (p *TCPProxy) addConn(pc *TCPProxyConn) bool {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 	if p.closed {
-		c.Close()
-	} else {
-		p.conns = append(p.conns, c)
+		pc.closeLocked()
+		return false
+	}
+	p.conns = append(p.conns, pc)
+	p.connected++
+	close(p.connChanged)
+	p.connChanged = make(chan struct{})
+	return true
+}
+
+// selectConns returns the active connections from the client with
+// the given address, or all active connections if the address is
+// empty.
+func (p *TCPProxy) selectConns(clientAddr string) []*TCPProxyConn {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var conns []*TCPProxyConn
+	for _, pc := range p.conns {
+		if clientAddr == "" || pc.client.RemoteAddr().String() == clientAddr {
+			conns = append(conns, pc)
+		}
+	}
+	return conns
+}
+
+// Conns returns the connections through the proxy
+// that are currently active, in the order they were made.
+func (p *TCPProxy) Conns() []*TCPProxyConn {
+	return p.selectConns("")
+}
+
+// WaitConns waits until at least n connections have been made
+// through the proxy since it was started, and returns the
+// connections that are currently active. It fails the test
+// if that does not happen within LongWait.
+func (p *TCPProxy) WaitConns(c *gc.C, n int) []*TCPProxyConn {
+	timeout := time.After(LongWait)
+	for {
+		p.mu.Lock()
+		connected, changed := p.connected, p.connChanged
+		p.mu.Unlock()
+		if connected >= n {
+			return p.Conns()
+		}
+		select {
+		case <-changed:
+		case <-timeout:
+			c.Fatalf("timed out waiting for %d connections through proxy (got %d)", n, connected)
+		}
 	}
 }
 
@@ -81,19 +434,102 @@ func (p *TCPProxy) Close() error {
 	defer p.mu.Unlock()
 	p.closed = true
 	p.listener.Close()
-	for _, c := range p.conns {
-		c.Close()
+	for _, pc := range p.conns {
+		pc.closeLocked()
 	}
+	p.stopStart.Broadcast()
+	return nil
+}
+
+// Restart restarts a proxy that has been closed, listening on the
+// same address as before, so that a test can simulate a server
+// going down and coming back. Connections that were closed when
+// the proxy was closed are not restored.
+func (p *TCPProxy) Restart() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.closed {
+		return fmt.Errorf("proxy is not closed")
+	}
+	listener, err := net.Listen(p.network, p.addr)
+	if err != nil {
+		return err
+	}
+	p.listener = listener
+	p.closed = false
+	go p.accept(listener)
 	return nil
 }
 
+// SetRemote sets the remote address that the proxy copies to and
+// from. Connections that are already active are not affected.
+func (p *TCPProxy) SetRemote(remoteAddr string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.remoteAddr = remoteAddr
+}
+
+// SetRefuseConns sets whether the proxy refuses new connections. While
+// it does, clients that connect to the proxy are accepted and then
+// immediately reset, without a connection being made to the remote
+// address. Connections that are already active are not affected.
+func (p *TCPProxy) SetRefuseConns(refuse bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.refuse = refuse
+}
+
 // CloseConns closes all the connections that are
 // currently active. The proxy itself remains active.
 func (p *TCPProxy) CloseConns() {
-	p.mu.Lock()
-	defer p.mu.Unlock()
-	for _, c := range p.conns {
-		c.Close()
+	for _, pc := range p.Conns() {
+		pc.Close()
+	}
+}
+
+// The fault injection methods below each take the address of a
+// client of the proxy, as returned by the LocalAddr method of its
+// connection, and apply to the connection from that client. If
+// the address is empty, they apply to all the connections that
+// are currently active. The TCPProxyConn methods of the same names
+// apply the faults to a single connection.
+
+// ResetConns resets the connections as for TCPProxyConn.Reset.
+func (p *TCPProxy) ResetConns(clientAddr string) {
+	for _, pc := range p.selectConns(clientAddr) {
+		pc.Reset()
+	}
+}
+
+// HalfCloseConns closes one direction of the connections
+// as for TCPProxyConn.HalfClose.
+func (p *TCPProxy) HalfCloseConns(dir Direction, clientAddr string) {
+	for _, pc := range p.selectConns(clientAddr) {
+		pc.HalfClose(dir)
+	}
+}
+
+// DropConnsAfter limits the data sent through the connections
+// as for TCPProxyConn.DropAfter.
+func (p *TCPProxy) DropConnsAfter(dir Direction, n int64, clientAddr string) {
+	for _, pc := range p.selectConns(clientAddr) {
+		pc.DropAfter(dir, n)
+	}
+}
+
+// BlackholeConns discards data sent through the connections
+// as for TCPProxyConn.Blackhole.
+func (p *TCPProxy) BlackholeConns(dir Direction, clientAddr string) {
+	for _, pc := range p.selectConns(clientAddr) {
+		pc.Blackhole(dir)
+	}
+}
+
+// CorruptConns corrupts data sent through the connections
+// as for TCPProxyConn.Corrupt.
+func (p *TCPProxy) CorruptConns(dir Direction, offset int64, clientAddr string) {
+	for _, pc := range p.selectConns(clientAddr) {
+		pc.Corrupt(dir, offset)
 	}
 }
 
@@ -106,6 +542,8 @@ func (p *TCPProxy) PauseConns() {
 }
 
 // ResumeConns resumes sending traffic through the proxy.
+// Traffic is still stopped in any direction paused with
+// PauseDirection.
 func (p *TCPProxy) ResumeConns() {
 	p.mu.Lock()
 	defer p.mu.Unlock()
@@ -113,42 +551,473 @@ func (p *TCPProxy) ResumeConns() {
 	p.stopStart.Broadcast()
 }
 
-// Addr returns the TCP address of the proxy. Dialing
-// this address will cause a connection to be made
+// PauseDirection stops traffic flowing through the proxy in
+// the given direction, while traffic in the other direction
+// continues to flow.
+func (p *TCPProxy) PauseDirection(dir Direction) {
+	p.setDirPaused(dir, true)
+}
+
+// ResumeDirection resumes sending traffic through the proxy
+// in the given direction. Traffic is still stopped while the
+// proxy is paused with PauseConns.
+func (p *TCPProxy) ResumeDirection(dir Direction) {
+	p.setDirPaused(dir, false)
+}
+
+func (p *TCPProxy) setDirPaused(dir Direction, paused bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.dirPaused[dir] = paused
+	p.stopStart.Broadcast()
+}
+
+// SetLinkConditions sets the conditions of the simulated link that
+// data flowing in the given direction travels over. The conditions
+// apply to all connections, including those that are already active,
+// from the next data that the proxy reads.
+func (p *TCPProxy) SetLinkConditions(dir Direction, conditions LinkConditions) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.links[dir] = conditions
+}
+
+// LinkConditions returns the conditions of the simulated link
+// that data flowing in the given direction travels over.
+func (p *TCPProxy) LinkConditions(dir Direction) LinkConditions {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.links[dir]
+}
+
+// SetRecordTraffic sets whether the traffic sent through the proxy
+// is recorded, so that it can be retrieved with TCPProxyConn.Traffic.
+// Recording applies to all connections, including those that are
+// already active, from the next data that is sent.
+func (p *TCPProxy) SetRecordTraffic(record bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.record = record
+}
+
+// SetChunkHook sets a hook that is called with each chunk of data that
+// is about to be sent through the proxy. Faults injected into a
+// connection apply to the data returned by the hook. If the hook is
+// nil, data is sent unchanged.
+func (p *TCPProxy) SetChunkHook(hook ChunkHook) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.chunkHook = hook
+}
+
+// Addr returns the address of the proxy, which is the path of
+// its socket for a proxy that listens on a Unix domain socket.
+// Dialing this address will cause a connection to be made
 // to the remote address; any data written will be
 // written there, and any data read from the remote
 // address will be available to read locally.
 func (p *TCPProxy) Addr() string {
-	// Note: this only works because we explicitly listen on 127.0.0.1 rather
-	// than the wildcard address.
-	return p.listener.Addr().String()
+	return p.addr
 }
 
-func (p *TCPProxy) isClosed() bool {
+// isStopped reports whether the proxy has stopped
+// accepting clients from the given listener, because
+// it has been closed or restarted.
+func (p *TCPProxy) isStopped(listener net.Listener) bool {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	return p.closed
+	return p.closed || p.listener != listener
 }
 
-func (p *TCPProxy) stream(dst io.WriteCloser, src io.ReadCloser) {
-	defer dst.Close()
-	defer src.Close()
-	buf := make([]byte, 32*1024)
-	for {
-		nr, err := src.Read(buf)
+// TCPProxyConn represents a connection made through a TCPProxy,
+// from a client of the proxy to the remote address.
+type TCPProxyConn struct {
+	proxy *TCPProxy
+	// client holds the connection from the client of the proxy.
+	client net.Conn
+	// server holds the connection to the remote address.
+	server net.Conn
+	// started holds the time the connection was made.
+	started time.Time
+	// done is closed when the connection is closed.
+	done chan struct{}
+
+	// The fields below are guarded by the mutex of the proxy.
+
+	// closed holds whether the connection has been closed.
+	closed bool
+	// paused holds whether the connection has been paused.
+	paused bool
+	// faults holds the faults injected in each direction.
+	faults [2]connFaults
+	// written holds the number of bytes written in each direction.
+	written [2]int64
+	// traffic holds the traffic recorded in each direction.
+	traffic [2]Traffic
+}
+
+// connFaults holds the faults injected into one
+// direction of a connection.
+type connFaults struct {
+	// halfClosed holds whether the direction has been closed.
+	halfClosed bool
+	// blackholed holds whether data is being discarded.
+	blackholed bool
+	// dropAfter holds the number of bytes after which the
+	// connection is closed, or zero if there is no limit.
+	dropAfter int64
+	// corruptAt holds the offsets of bytes still to be corrupted.
+	corruptAt []int64
+}
+
+func newTCPProxyConn(p *TCPProxy, client, server net.Conn) *TCPProxyConn {
+	return &TCPProxyConn{
+		proxy:   p,
+		client:  client,
+		server:  server,
+		started: time.Now(),
+		done:    make(chan struct{}),
+	}
+}
+
+// ClientAddr returns the address of the client that made the
+// connection, which is the local address of its connection.
+func (pc *TCPProxyConn) ClientAddr() net.Addr {
+	return pc.client.RemoteAddr()
+}
+
+// RemoteAddr returns the remote address that
+// the connection was made to.
+func (pc *TCPProxyConn) RemoteAddr() net.Addr {
+	return pc.server.RemoteAddr()
+}
+
+// Started returns the time the connection was made.
+func (pc *TCPProxyConn) Started() time.Time {
+	return pc.started
+}
+
+// Bytes returns the number of bytes that have been sent
+// through the connection in the given direction.
+func (pc *TCPProxyConn) Bytes(dir Direction) int64 {
+	pc.proxy.mu.Lock()
+	defer pc.proxy.mu.Unlock()
+	return pc.written[dir]
+}
+
+// Traffic returns the traffic that has been recorded in the given
+// direction of the connection while the proxy was recording. The
+// returned chunks hold the data as it was sent, after the chunk
+// hook and any faults were applied.
+func (pc *TCPProxyConn) Traffic(dir Direction) Traffic {
+	pc.proxy.mu.Lock()
+	defer pc.proxy.mu.Unlock()
+	return append(Traffic(nil), pc.traffic[dir]...)
+}
+
+// Pause stops traffic flowing through the connection.
+func (pc *TCPProxyConn) Pause() {
+	pc.setPaused(true)
+}
+
+// Resume resumes sending traffic through the connection.
+// Traffic is still stopped while the whole proxy is paused.
+func (pc *TCPProxyConn) Resume() {
+	pc.setPaused(false)
+}
+
+func (pc *TCPProxyConn) setPaused(paused bool) {
+	pc.proxy.mu.Lock()
+	defer pc.proxy.mu.Unlock()
+	pc.paused = paused
+	pc.proxy.stopStart.Broadcast()
+}
+
+// Close closes the connection.
+func (pc *TCPProxyConn) Close() error {
+	pc.proxy.mu.Lock()
+	defer pc.proxy.mu.Unlock()
+	pc.closeLocked()
+	return nil
+}
+
+// Reset abruptly closes the connection, so that both the client
+// and the remote server see the connection reset rather than closed.
+func (pc *TCPProxyConn) Reset() {
+	pc.proxy.mu.Lock()
+	defer pc.proxy.mu.Unlock()
+	setNoLinger(pc.client)
+	setNoLinger(pc.server)
+	pc.closeLocked()
+}
+
+// setNoLinger sets the linger time of a TCP connection to
+// zero, which makes closing the connection send a RST.
+func setNoLinger(conn net.Conn) {
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		tcpConn.SetLinger(0)
+	}
+}
+
+// resetConn closes the connection so that its peer sees it reset.
+func resetConn(conn net.Conn) {
+	setNoLinger(conn)
+	conn.Close()
+}
+
+// HalfClose closes the connection in the given direction only,
+// so that the receiving end sees the end of the data while data can
+// still flow in the other direction. Any further data sent in the
+// given direction is discarded.
+func (pc *TCPProxyConn) HalfClose(dir Direction) {
+	pc.proxy.mu.Lock()
+	defer pc.proxy.mu.Unlock()
+	pc.faults[dir].halfClosed = true
+	_, dst := pc.ends(dir)
+	if conn, ok := dst.(interface{ CloseWrite() error }); ok {
+		conn.CloseWrite()
+	}
+}
+
+// DropAfter closes the connection once n bytes in total have
+// been sent through it in the given direction. The connection
+// is closed immediately if that many bytes have already been sent.
+func (pc *TCPProxyConn) DropAfter(dir Direction, n int64) {
+	pc.proxy.mu.Lock()
+	defer pc.proxy.mu.Unlock()
+	if pc.written[dir] >= n {
+		pc.closeLocked()
+	} else {
+		pc.faults[dir].dropAfter = n
+	}
+}
+
+// Blackhole silently discards all further data sent through the
+// connection in the given direction, without closing it.
+func (pc *TCPProxyConn) Blackhole(dir Direction) {
+	pc.proxy.mu.Lock()
+	defer pc.proxy.mu.Unlock()
+	pc.faults[dir].blackholed = true
+}
+
+// Corrupt corrupts the byte at the given offset in the data sent
+// through the connection in the given direction, by inverting all its
+// bits. The offset counts all the data sent in that direction since
+// the connection was made, so a byte that has already been sent is
+// not corrupted.
+func (pc *TCPProxyConn) Corrupt(dir Direction, offset int64) {
+	pc.proxy.mu.Lock()
+	defer pc.proxy.mu.Unlock()
+	if offset >= pc.written[dir] {
+		pc.faults[dir].corruptAt = append(pc.faults[dir].corruptAt, offset)
+	}
+}
+
+// ends returns the connections that data flowing
+// in the given direction is read from and written to.
+func (pc *TCPProxyConn) ends(dir Direction) (src, dst net.Conn) {
+	if dir == ClientToServer {
+		return pc.client, pc.server
+	}
+	return pc.server, pc.client
+}
+
+// closeLocked closes the connection and removes it from the
+// active connections of the proxy. It must be called with
+// the mutex of the proxy held.
+func (pc *TCPProxyConn) closeLocked() {
+	pc.client.Close()
+	pc.server.Close()
+	if pc.closed {
+		return
+	}
+	pc.closed = true
+	close(pc.done)
+	p := pc.proxy
+	// Wake the streams of the connection if they are paused.
+	p.stopStart.Broadcast()
+	for i, c := range p.conns {
+		if c == pc {
+			p.conns = append(p.conns[:i:i], p.conns[i+1:]...)
+			break
+		}
+	}
+}
+
+// applyFaults applies the faults injected into the given direction
+// to the data, which is about to be written, and records the data
+// as written. It returns the data to write, and whether the
+// connection should be closed after writing it.
+func (p *TCPProxy) applyFaults(pc *TCPProxyConn, dir Direction, data []byte) ([]byte, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	f := &pc.faults[dir]
+	if f.halfClosed || f.blackholed {
+		return nil, false
+	}
+	start := pc.written[dir]
+	drop := false
+	if f.dropAfter > 0 && start+int64(len(data)) >= f.dropAfter {
+		data = data[:f.dropAfter-start]
+		drop = true
+	}
+	remaining := f.corruptAt[:0]
+	copied := false
+	for _, offset := range f.corruptAt {
+		if offset >= start && offset < start+int64(len(data)) {
+			if !copied {
+				// The data may have been returned by
+				// the chunk hook, so don't change it.
+				data = append([]byte(nil), data...)
+				copied = true
+			}
+			data[offset-start] ^= 0xff
+		} else {
+			remaining = append(remaining, offset)
+		}
+	}
+	f.corruptAt = remaining
+	pc.written[dir] += int64(len(data))
+	if p.record && len(data) > 0 {
+		pc.traffic[dir] = append(pc.traffic[dir], TrafficChunk{
+			Time: time.Now(),
+			Data: append([]byte(nil), data...),
+		})
+	}
+	return data, drop
+}
+
+// isHalfClosed reports whether the given direction
+// of the connection has been closed.
+func (p *TCPProxy) isHalfClosed(pc *TCPProxyConn, dir Direction) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return pc.faults[dir].halfClosed
+}
+
+// proxyChunk holds a chunk of data read by the proxy,
+// and the time it should be written.
+type proxyChunk struct {
+	data      []byte
+	deliverAt time.Time
+}
+
+// linkState holds the state of the simulated
+// link in one direction of a connection.
+type linkState struct {
+	// sent holds the time that the last chunk
+	// finished being sent, given the bandwidth.
+	sent time.Time
+	// delivered holds the time that the last
+	// chunk is due to be delivered.
+	delivered time.Time
+}
+
+// stream copies data flowing in the given direction
+// through the connection until either end fails.
+func (p *TCPProxy) stream(pc *TCPProxyConn, dir Direction) {
+	src, dst := pc.ends(dir)
+	defer pc.Close()
+	// The data is read in a separate goroutine so that
+	// reading continues while earlier data is delayed.
+	chunks := make(chan proxyChunk, 64)
+	done := make(chan struct{})
+	defer close(done)
+	go p.readChunks(dir, src, chunks, done)
+	for chunk := range chunks {
+		if d := time.Until(chunk.deliverAt); d > 0 {
+			select {
+			case <-time.After(d):
+			case <-pc.done:
+				return
+			}
+		}
 		p.mu.Lock()
-		for p.paused {
+		for (p.paused || p.dirPaused[dir] || pc.paused) && !pc.closed {
 			p.stopStart.Wait()
 		}
+		closed := pc.closed
+		hook := p.chunkHook
 		p.mu.Unlock()
-		if nr > 0 {
-			_, err := dst.Write(buf[0:nr])
-			if err != nil {
-				break
+		if closed {
+			return
+		}
+		data := chunk.data
+		if hook != nil {
+			data = hook(pc, dir, data)
+		}
+		data, drop := p.applyFaults(pc, dir, data)
+		if len(data) > 0 {
+			if _, err := dst.Write(data); err != nil && !p.isHalfClosed(pc, dir) {
+				return
+			}
+		}
+		if drop {
+			return
+		}
+	}
+}
+
+// readChunks reads data flowing in the given direction from src and
+// sends it on the chunks channel, scheduled according to the link
+// conditions, until reading fails or the done channel is closed.
+func (p *TCPProxy) readChunks(dir Direction, src io.Reader, chunks chan<- proxyChunk, done <-chan struct{}) {
+	defer close(chunks)
+	var link linkState
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			for _, chunk := range p.schedule(dir, &link, buf[:n]) {
+				select {
+				case chunks <- chunk:
+				case <-done:
+					return
+				}
 			}
 		}
 		if err != nil {
-			break
+			return
+		}
+	}
+}
+
+// schedule returns the given data, which has just been read, split
+// into chunks with the times that they should be delivered according
+// to the current conditions of the link in the given direction.
+func (p *TCPProxy) schedule(dir Direction, link *linkState, data []byte) []proxyChunk {
+	conditions := p.LinkConditions(dir)
+	now := time.Now()
+	size := len(data)
+	if conditions.Bandwidth > 0 {
+		// Split the data so that it is delivered
+		// smoothly rather than in bursts.
+		size = max(1, conditions.Bandwidth/50)
+	}
+	var chunks []proxyChunk
+	for len(data) > 0 {
+		n := min(size, len(data))
+		sent := now
+		if conditions.Bandwidth > 0 {
+			if link.sent.After(sent) {
+				sent = link.sent
+			}
+			sent = sent.Add(time.Duration(n) * time.Second / time.Duration(conditions.Bandwidth))
+			link.sent = sent
+		}
+		deliverAt := sent.Add(conditions.Latency)
+		if conditions.Jitter > 0 {
+			deliverAt = deliverAt.Add(time.Duration(rand.Int63n(int64(conditions.Jitter) + 1)))
+		}
+		if deliverAt.Before(link.delivered) {
+			deliverAt = link.delivered
 		}
+		link.delivered = deliverAt
+		chunks = append(chunks, proxyChunk{
+			data:      append([]byte(nil), data[:n]...),
+			deliverAt: deliverAt,
+		})
+		data = data[n:]
 	}
+	return chunks
 }
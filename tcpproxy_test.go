@@ -4,9 +4,12 @@
 package testing_test
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"net"
+	"path/filepath"
+	"runtime"
 	"sync"
 	"time"
 
@@ -142,6 +145,554 @@ func (*tcpProxySuite) TestPauseConns(c *gc.C) {
 	c.Assert(string(buf), gc.Equals, msg)
 }
 
+func (*tcpProxySuite) TestCloseWhilePaused(c *gc.C) {
+	p, conn := newEchoProxy(c)
+	defer conn.Close()
+
+	p.PauseConns()
+	_, err := fmt.Fprint(conn, "hello")
+	c.Assert(err, gc.IsNil)
+	assertReadTimeout(c, conn)
+	p.Close()
+	assertEOF(c, conn)
+	assertStreamsDone(c)
+}
+
+func (*tcpProxySuite) TestCloseWhileDelayed(c *gc.C) {
+	p, conn := newEchoProxy(c)
+	defer conn.Close()
+
+	p.SetLinkConditions(testing.ClientToServer, testing.LinkConditions{
+		Latency: time.Hour,
+	})
+	_, err := fmt.Fprint(conn, "hello")
+	c.Assert(err, gc.IsNil)
+	assertReadTimeout(c, conn)
+	p.Close()
+	assertEOF(c, conn)
+	assertStreamsDone(c)
+}
+
+// assertStreamsDone checks that no goroutines
+// are left copying data through a TCPProxy.
+func assertStreamsDone(c *gc.C) {
+	timeout := time.After(testing.LongWait)
+	for {
+		buf := make([]byte, 1<<20)
+		buf = buf[:runtime.Stack(buf, true)]
+		if !bytes.Contains(buf, []byte("testing.(*TCPProxy).stream(")) {
+			return
+		}
+		select {
+		case <-time.After(10 * time.Millisecond):
+		case <-timeout:
+			c.Fatalf("proxy streams still running after close:\n%s", buf)
+		}
+	}
+}
+
+func (*tcpProxySuite) TestLatency(c *gc.C) {
+	p, conn := newEchoProxy(c)
+	defer p.Close()
+	defer conn.Close()
+
+	p.SetLinkConditions(testing.ClientToServer, testing.LinkConditions{
+		Latency: 100 * time.Millisecond,
+	})
+	p.SetLinkConditions(testing.ServerToClient, testing.LinkConditions{
+		Latency: 50 * time.Millisecond,
+		Jitter:  10 * time.Millisecond,
+	})
+	c.Check(p.LinkConditions(testing.ClientToServer), gc.Equals, testing.LinkConditions{
+		Latency: 100 * time.Millisecond,
+	})
+	start := time.Now()
+	assertEcho(c, conn)
+	elapsed := time.Since(start)
+	c.Check(elapsed >= 150*time.Millisecond, gc.Equals, true, gc.Commentf("round trip took %v", elapsed))
+
+	// The conditions can be changed while the connection is active.
+	p.SetLinkConditions(testing.ClientToServer, testing.LinkConditions{})
+	p.SetLinkConditions(testing.ServerToClient, testing.LinkConditions{})
+	start = time.Now()
+	assertEcho(c, conn)
+	elapsed = time.Since(start)
+	c.Check(elapsed < 100*time.Millisecond, gc.Equals, true, gc.Commentf("round trip took %v", elapsed))
+}
+
+func (*tcpProxySuite) TestLatencyPipelined(c *gc.C) {
+	p, conn := newEchoProxy(c)
+	defer p.Close()
+	defer conn.Close()
+
+	// Data that is written while earlier data is still in
+	// flight is delayed by the latency only once.
+	p.SetLinkConditions(testing.ClientToServer, testing.LinkConditions{
+		Latency: 100 * time.Millisecond,
+	})
+	start := time.Now()
+	var sent string
+	for i := 0; i < 5; i++ {
+		msg := fmt.Sprintf("message %d\n", i)
+		_, err := fmt.Fprint(conn, msg)
+		c.Assert(err, gc.IsNil)
+		sent += msg
+		time.Sleep(20 * time.Millisecond)
+	}
+	buf := make([]byte, len(sent))
+	_, err := io.ReadFull(conn, buf)
+	c.Assert(err, gc.IsNil)
+	c.Check(string(buf), gc.Equals, sent)
+	elapsed := time.Since(start)
+	c.Check(elapsed >= 180*time.Millisecond, gc.Equals, true, gc.Commentf("messages took %v", elapsed))
+	c.Check(elapsed < 400*time.Millisecond, gc.Equals, true, gc.Commentf("messages took %v", elapsed))
+}
+
+func (*tcpProxySuite) TestBandwidth(c *gc.C) {
+	p, conn := newEchoProxy(c)
+	defer p.Close()
+	defer conn.Close()
+
+	p.SetLinkConditions(testing.ServerToClient, testing.LinkConditions{
+		Bandwidth: 20000,
+	})
+	data := make([]byte, 5000)
+	start := time.Now()
+	_, err := conn.Write(data)
+	c.Assert(err, gc.IsNil)
+	_, err = io.ReadFull(conn, data)
+	c.Assert(err, gc.IsNil)
+	elapsed := time.Since(start)
+	c.Check(elapsed >= 240*time.Millisecond, gc.Equals, true, gc.Commentf("transfer took %v", elapsed))
+	c.Check(elapsed < testing.LongWait, gc.Equals, true)
+}
+
+func (*tcpProxySuite) TestResetConns(c *gc.C) {
+	p, conn := newEchoProxy(c)
+	defer p.Close()
+	defer conn.Close()
+
+	p.ResetConns("")
+	_, err := conn.Read(make([]byte, 1))
+	c.Assert(err, gc.ErrorMatches, ".*connection reset by peer")
+}
+
+func (*tcpProxySuite) TestHalfCloseConns(c *gc.C) {
+	p, conn := newEchoProxy(c)
+	defer p.Close()
+	defer conn.Close()
+
+	// Closing the direction to the client leaves the
+	// direction to the server working.
+	p.HalfCloseConns(testing.ServerToClient, "")
+	assertEOF(c, conn)
+	_, err := fmt.Fprint(conn, "hello, world\n")
+	c.Assert(err, gc.IsNil)
+}
+
+func (*tcpProxySuite) TestDropConnsAfter(c *gc.C) {
+	p, conn := newEchoProxy(c)
+	defer p.Close()
+	defer conn.Close()
+
+	// The echo in newEchoProxy has already sent 13 bytes.
+	p.DropConnsAfter(testing.ServerToClient, 20, "")
+	_, err := fmt.Fprint(conn, "0123456789")
+	c.Assert(err, gc.IsNil)
+	data, err := io.ReadAll(conn)
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Equals, "0123456")
+}
+
+func (*tcpProxySuite) TestBlackholeConns(c *gc.C) {
+	p, conn := newEchoProxy(c)
+	defer p.Close()
+	defer conn.Close()
+
+	p.BlackholeConns(testing.ClientToServer, "")
+	_, err := fmt.Fprint(conn, "hello, world\n")
+	c.Assert(err, gc.IsNil)
+	assertReadTimeout(c, conn)
+}
+
+func (*tcpProxySuite) TestCorruptConns(c *gc.C) {
+	p, conn := newEchoProxy(c)
+	defer p.Close()
+	defer conn.Close()
+
+	// Offsets count from the start of the connection, which
+	// has already carried 13 bytes in each direction.
+	p.CorruptConns(testing.ClientToServer, 14, "")
+	_, err := fmt.Fprint(conn, "abc")
+	c.Assert(err, gc.IsNil)
+	buf := make([]byte, 3)
+	_, err = io.ReadFull(conn, buf)
+	c.Assert(err, gc.IsNil)
+	c.Assert(buf, gc.DeepEquals, []byte{'a', 'b' ^ 0xff, 'c'})
+
+	// The corruption applies only once.
+	assertEcho(c, conn)
+}
+
+func (*tcpProxySuite) TestFaultSelectedConn(c *gc.C) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, gc.IsNil)
+	defer listener.Close()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go tcpEcho(&wg, listener)
+
+	p := testing.NewTCPProxy(c, listener.Addr().String())
+	defer p.Close()
+	conn1, err := net.Dial("tcp", p.Addr())
+	c.Assert(err, gc.IsNil)
+	defer conn1.Close()
+	assertEcho(c, conn1)
+	conn2, err := net.Dial("tcp", p.Addr())
+	c.Assert(err, gc.IsNil)
+	defer conn2.Close()
+	assertEcho(c, conn2)
+
+	// Only the connection from the selected client is affected.
+	p.BlackholeConns(testing.ServerToClient, conn1.LocalAddr().String())
+	_, err = fmt.Fprint(conn1, "hello, world\n")
+	c.Assert(err, gc.IsNil)
+	assertReadTimeout(c, conn1)
+	assertEcho(c, conn2)
+}
+
+func (*tcpProxySuite) TestConns(c *gc.C) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, gc.IsNil)
+	defer listener.Close()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go tcpEcho(&wg, listener)
+
+	p := testing.NewTCPProxy(c, listener.Addr().String())
+	defer p.Close()
+	c.Assert(p.Conns(), gc.HasLen, 0)
+
+	start := time.Now()
+	conn1, err := net.Dial("tcp", p.Addr())
+	c.Assert(err, gc.IsNil)
+	defer conn1.Close()
+	conn2, err := net.Dial("tcp", p.Addr())
+	c.Assert(err, gc.IsNil)
+	defer conn2.Close()
+	conns := p.WaitConns(c, 2)
+	c.Assert(conns, gc.HasLen, 2)
+	if conns[0].ClientAddr().String() != conn1.LocalAddr().String() {
+		conns[0], conns[1] = conns[1], conns[0]
+	}
+	c.Assert(conns[0].ClientAddr().String(), gc.Equals, conn1.LocalAddr().String())
+	c.Assert(conns[1].ClientAddr().String(), gc.Equals, conn2.LocalAddr().String())
+	c.Assert(conns[0].RemoteAddr().String(), gc.Equals, listener.Addr().String())
+	c.Assert(conns[0].Started().Before(start), gc.Equals, false)
+
+	assertEcho(c, conn1)
+	c.Assert(conns[0].Bytes(testing.ClientToServer), gc.Equals, int64(13))
+	c.Assert(conns[0].Bytes(testing.ServerToClient), gc.Equals, int64(13))
+	c.Assert(conns[1].Bytes(testing.ServerToClient), gc.Equals, int64(0))
+
+	// Pausing one connection leaves the other working.
+	conns[0].Pause()
+	_, err = fmt.Fprint(conn1, "hello, world\n")
+	c.Assert(err, gc.IsNil)
+	assertReadTimeout(c, conn1)
+	assertEcho(c, conn2)
+	conns[0].Resume()
+	buf := make([]byte, 13)
+	_, err = io.ReadFull(conn1, buf)
+	c.Assert(err, gc.IsNil)
+
+	// A closed connection is no longer active.
+	conns[0].Close()
+	assertEOF(c, conn1)
+	remaining := p.Conns()
+	c.Assert(remaining, gc.HasLen, 1)
+	c.Assert(remaining[0], gc.Equals, conns[1])
+	conns[1].Blackhole(testing.ServerToClient)
+	_, err = fmt.Fprint(conn2, "hello, world\n")
+	c.Assert(err, gc.IsNil)
+	assertReadTimeout(c, conn2)
+}
+
+func (*tcpProxySuite) TestRecordTraffic(c *gc.C) {
+	p, conn := newEchoProxy(c)
+	defer p.Close()
+	defer conn.Close()
+
+	p.SetRecordTraffic(true)
+	assertEcho(c, conn)
+	_, err := fmt.Fprint(conn, "\x00\x01")
+	c.Assert(err, gc.IsNil)
+	_, err = io.ReadFull(conn, make([]byte, 2))
+	c.Assert(err, gc.IsNil)
+	p.SetRecordTraffic(false)
+	assertEcho(c, conn)
+
+	pc := p.Conns()[0]
+	// Data sent before and after recording is not recorded.
+	traffic := pc.Traffic(testing.ServerToClient)
+	c.Assert(string(traffic.Bytes()), gc.Equals, "hello, world\n\x00\x01")
+	data, err := io.ReadAll(pc.Traffic(testing.ClientToServer).Reader())
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Equals, "hello, world\n\x00\x01")
+	c.Assert(traffic, gc.HasLen, 2)
+	c.Assert(traffic[1].Time.Before(traffic[0].Time), gc.Equals, false)
+	c.Assert(traffic.String(), gc.Matches, `\+0s "hello, world\\n"\n\+[0-9.]+[µm]?s "\\x00\\x01"\n`)
+	c.Assert(traffic.HexDump(), gc.Matches, `(?s)\+0s 13 bytes\n00000000  68 65 6c 6c.*\+[0-9.]+[µm]?s 2 bytes\n00000000  00 01 .*`)
+}
+
+func (*tcpProxySuite) TestChunkHook(c *gc.C) {
+	p, conn := newEchoProxy(c)
+	defer p.Close()
+	defer conn.Close()
+
+	var mu sync.Mutex
+	var seen []string
+	p.SetChunkHook(func(pc *testing.TCPProxyConn, dir testing.Direction, data []byte) []byte {
+		mu.Lock()
+		defer mu.Unlock()
+		seen = append(seen, fmt.Sprintf("%v: %q", dir, data))
+		if dir == testing.ServerToClient {
+			return append([]byte("frame:"), data...)
+		}
+		return data
+	})
+	_, err := fmt.Fprint(conn, "ping")
+	c.Assert(err, gc.IsNil)
+	buf := make([]byte, len("frame:ping"))
+	_, err = io.ReadFull(conn, buf)
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(buf), gc.Equals, "frame:ping")
+	mu.Lock()
+	c.Assert(seen, gc.DeepEquals, []string{
+		`client to server: "ping"`,
+		`server to client: "ping"`,
+	})
+	mu.Unlock()
+
+	p.SetChunkHook(nil)
+	assertEcho(c, conn)
+}
+
+func (*tcpProxySuite) TestStartTCPProxyDialFailure(c *gc.C) {
+	// Find an address with nothing listening on it.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, gc.IsNil)
+	remoteAddr := listener.Addr().String()
+	listener.Close()
+
+	errors := make(chan error, 10)
+	p, err := testing.StartTCPProxy(testing.TCPProxyConfig{
+		RemoteAddr: remoteAddr,
+		OnError: func(err error) {
+			errors <- err
+		},
+	})
+	c.Assert(err, gc.IsNil)
+	defer p.Close()
+
+	// The client is disconnected and the error reported.
+	conn, err := net.Dial("tcp", p.Addr())
+	c.Assert(err, gc.IsNil)
+	defer conn.Close()
+	assertEOF(c, conn)
+	select {
+	case err := <-errors:
+		c.Assert(err, gc.ErrorMatches, "cannot dial remote address: .*connection refused")
+	case <-time.After(testing.LongWait):
+		c.Fatalf("no error reported")
+	}
+	c.Assert(p.Stats(), gc.Equals, testing.TCPProxyStats{
+		Accepted: 1,
+		Failed:   1,
+	})
+
+	// The proxy continues to accept clients, and connects
+	// them once the remote address is listening again.
+	listener, err = net.Listen("tcp", remoteAddr)
+	c.Assert(err, gc.IsNil)
+	defer listener.Close()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go tcpEcho(&wg, listener)
+	conn, err = net.Dial("tcp", p.Addr())
+	c.Assert(err, gc.IsNil)
+	defer conn.Close()
+	assertEcho(c, conn)
+	c.Assert(p.Stats(), gc.Equals, testing.TCPProxyStats{
+		Accepted: 2,
+		Failed:   1,
+		Active:   1,
+	})
+
+	// Closing the proxy does not report an error.
+	p.Close()
+	assertEOF(c, conn)
+	c.Assert(p.Stats().Active, gc.Equals, 0)
+	select {
+	case err := <-errors:
+		c.Fatalf("unexpected error %v", err)
+	default:
+	}
+}
+
+func (*tcpProxySuite) TestSetRemote(c *gc.C) {
+	p, conn1 := newEchoProxy(c)
+	defer p.Close()
+	defer conn1.Close()
+
+	// Start a server that writes a greeting, and
+	// point the proxy at it.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, gc.IsNil)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			fmt.Fprint(conn, "hello\n")
+			conn.Close()
+		}
+	}()
+	p.SetRemote(listener.Addr().String())
+
+	conn2, err := net.Dial("tcp", p.Addr())
+	c.Assert(err, gc.IsNil)
+	defer conn2.Close()
+	data, err := io.ReadAll(conn2)
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Equals, "hello\n")
+
+	// The existing connection is still made to the echo server.
+	assertEcho(c, conn1)
+}
+
+func (*tcpProxySuite) TestRefuseConns(c *gc.C) {
+	p, conn1 := newEchoProxy(c)
+	defer p.Close()
+	defer conn1.Close()
+
+	p.SetRefuseConns(true)
+	conn2, err := net.Dial("tcp", p.Addr())
+	c.Assert(err, gc.IsNil)
+	defer conn2.Close()
+	_, err = conn2.Read(make([]byte, 1))
+	c.Assert(err, gc.ErrorMatches, ".*connection reset by peer")
+	c.Assert(p.Stats(), gc.Equals, testing.TCPProxyStats{
+		Accepted: 2,
+		Refused:  1,
+		Active:   1,
+	})
+
+	// The existing connection is not affected.
+	assertEcho(c, conn1)
+}
+
+func (*tcpProxySuite) TestRestart(c *gc.C) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, gc.IsNil)
+	defer listener.Close()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go tcpEcho(&wg, listener)
+
+	p := testing.NewTCPProxy(c, listener.Addr().String())
+	defer p.Close()
+	addr := p.Addr()
+	c.Assert(p.Restart(), gc.ErrorMatches, "proxy is not closed")
+
+	p.Close()
+	_, err = net.Dial("tcp", addr)
+	c.Assert(err, gc.ErrorMatches, ".*connection refused")
+
+	err = p.Restart()
+	c.Assert(err, gc.IsNil)
+	c.Assert(p.Addr(), gc.Equals, addr)
+	conn, err := net.Dial("tcp", addr)
+	c.Assert(err, gc.IsNil)
+	defer conn.Close()
+	assertEcho(c, conn)
+}
+
+func (*tcpProxySuite) TestUnixProxy(c *gc.C) {
+	listener, err := net.Listen("unix", filepath.Join(c.MkDir(), "echo.sock"))
+	c.Assert(err, gc.IsNil)
+	defer listener.Close()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go tcpEcho(&wg, listener)
+
+	p := testing.NewUnixProxy(c, listener.Addr().String())
+	defer p.Close()
+	conn, err := net.Dial("unix", p.Addr())
+	c.Assert(err, gc.IsNil)
+	defer conn.Close()
+	assertEcho(c, conn)
+
+	p.PauseConns()
+	_, err = fmt.Fprint(conn, "hello, world\n")
+	c.Assert(err, gc.IsNil)
+	assertReadTimeout(c, conn)
+	p.ResumeConns()
+	_, err = io.ReadFull(conn, make([]byte, 13))
+	c.Assert(err, gc.IsNil)
+
+	p.CloseConns()
+	assertEOF(c, conn)
+}
+
+func (*tcpProxySuite) TestTCPToUnixProxy(c *gc.C) {
+	listener, err := net.Listen("unix", filepath.Join(c.MkDir(), "echo.sock"))
+	c.Assert(err, gc.IsNil)
+	defer listener.Close()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go tcpEcho(&wg, listener)
+
+	p := testing.NewTCPToUnixProxy(c, listener.Addr().String())
+	defer p.Close()
+	conn, err := net.Dial("tcp", p.Addr())
+	c.Assert(err, gc.IsNil)
+	defer conn.Close()
+	assertEcho(c, conn)
+
+	p.Close()
+	assertEOF(c, conn)
+}
+
+func (*tcpProxySuite) TestStartTCPProxyUnixNeedsAddr(c *gc.C) {
+	_, err := testing.StartTCPProxy(testing.TCPProxyConfig{
+		Network:    "unix",
+		RemoteAddr: "/nowhere",
+	})
+	c.Assert(err, gc.ErrorMatches, "no address specified for unix proxy")
+}
+
+// newEchoProxy starts an echo server and a proxy to it,
+// and returns the proxy and a connection through it.
+func newEchoProxy(c *gc.C) (*testing.TCPProxy, net.Conn) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, gc.IsNil)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go tcpEcho(&wg, listener)
+	p := testing.NewTCPProxy(c, listener.Addr().String())
+	conn, err := net.Dial("tcp", p.Addr())
+	c.Assert(err, gc.IsNil)
+	// Once the connection has been made all the way to the
+	// echo server, closing the listener stops new connections
+	// to it without affecting the one made through the proxy.
+	assertEcho(c, conn)
+	listener.Close()
+	return p, conn
+}
+
 // tcpEcho listens on the given listener for TCP connections,
 // writes all traffic received back to the sender, and calls
 // wg.Done when all its goroutines have completed.
@@ -0,0 +1,128 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package testing
+
+import (
+	"strings"
+	"time"
+
+	gc "gopkg.in/check.v1"
+
+	jc "github.com/juju/testing/checkers"
+)
+
+// DefaultTestZones holds the time zones used by TimeZoneSuite.RunInZones
+// when the suite does not specify any. As well as UTC, it holds zones
+// with unusual offsets from UTC (+12:45 and -03:30) which tend to
+// expose code that assumes whole-hour offsets or a UTC local time.
+var DefaultTestZones = []string{
+	"UTC",
+	"Pacific/Chatham",
+	"America/St_Johns",
+}
+
+// testLocale holds the locale that TimeZoneSuite pins for each test.
+const testLocale = "C"
+
+// TimeZoneSuite isolates the tests from the time zone and locale of
+// the machine running them. The local time zone (both time.Local and
+// $TZ) and the locale ($LANG and $LC_ALL) are patched in SetUpTest and
+// restored in TearDownTest.
+//
+// Note that time.Local is read without synchronisation by the time
+// package, including by time.Now, so when tests are run with -race,
+// the race detector reports any goroutine that is still running when
+// it is patched, such as a server or proxy started by an earlier test.
+// Suites that embed TimeZoneSuite should expect such reports, and may
+// need to skip when RaceEnabled is true.
+type TimeZoneSuite struct {
+	// Zone holds the name of the time zone that is made local for
+	// each test. If it is empty, UTC is used.
+	Zone string
+
+	// Zones holds the names of the time zones that RunInZones runs
+	// its function in. If it is empty, DefaultTestZones is used.
+	Zones []string
+
+	restore Restorer
+}
+
+func (s *TimeZoneSuite) SetUpSuite(c *gc.C) {}
+
+func (s *TimeZoneSuite) TearDownSuite(c *gc.C) {}
+
+func (s *TimeZoneSuite) SetUpTest(c *gc.C) {
+	zone := s.Zone
+	if zone == "" {
+		zone = "UTC"
+	}
+	restore, err := PatchTimeZone(zone)
+	c.Assert(err, jc.ErrorIsNil)
+	restore = restore.Add(PatchEnvironment("LANG", testLocale))
+	restore = restore.Add(PatchEnvironment("LC_ALL", testLocale))
+	s.restore = restore
+}
+
+func (s *TimeZoneSuite) TearDownTest(c *gc.C) {
+	if s.restore != nil {
+		s.restore()
+		s.restore = nil
+	}
+}
+
+// RunInZones calls f once for each of the suite's time zones, with
+// that zone made local for the duration of the call. The zone is
+// logged before each call, and again after any call that reports a
+// failure, so that failures can be attributed to the zone they
+// occurred in.
+func (s *TimeZoneSuite) RunInZones(c *gc.C, f func(c *gc.C)) {
+	zones := s.Zones
+	if len(zones) == 0 {
+		zones = DefaultTestZones
+	}
+	for _, zone := range zones {
+		s.runInZone(c, zone, f)
+	}
+}
+
+func (s *TimeZoneSuite) runInZone(c *gc.C, zone string, f func(c *gc.C)) {
+	restore, err := PatchTimeZone(zone)
+	c.Assert(err, jc.ErrorIsNil)
+	wasFailed := c.Failed()
+	logLen := len(c.GetTestLog())
+	// The deferred function runs even if f calls c.FailNow,
+	// which makes sure that the zone is always restored.
+	defer func() {
+		restore()
+		if !c.Failed() {
+			return
+		}
+		// The test may already have failed in an earlier zone, so
+		// look for failures reported in this one. Gocheck prefixes
+		// each line of a failure report with "... ", unlike lines
+		// logged with c.Logf.
+		failed := !wasFailed || strings.Contains("\n"+c.GetTestLog()[logLen:], "\n... ")
+		if failed {
+			c.Logf("test failed in time zone %q", zone)
+		}
+	}()
+	c.Logf("running in time zone %q", zone)
+	f(c)
+}
+
+// PatchTimeZone loads the named time zone and makes it local by
+// setting both time.Local and the TZ environment variable. It returns
+// a function that restores the previous values.
+//
+// Setting time.Local races with any other goroutine that uses local
+// times, including through time.Now, so tests that call it will get
+// reports from the race detector unless no such goroutines are running.
+func PatchTimeZone(name string) (Restorer, error) {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	restore := PatchValue(&time.Local, loc)
+	return restore.Add(PatchEnvironment("TZ", name)), nil
+}
@@ -0,0 +1,117 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package testing_test
+
+import (
+	"bytes"
+	"os"
+	"time"
+
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+)
+
+type timeZoneSuite struct{}
+
+var _ = gc.Suite(&timeZoneSuite{})
+
+func (*timeZoneSuite) SetUpSuite(c *gc.C) {
+	if testing.RaceEnabled {
+		c.Skip("patching time.Local races with goroutines left running by other tests")
+	}
+}
+
+func (*timeZoneSuite) TestPatchTimeZone(c *gc.C) {
+	origLocal := time.Local
+	origTZ, origTZSet := os.LookupEnv("TZ")
+
+	restore, err := testing.PatchTimeZone("Pacific/Chatham")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(time.Local.String(), gc.Equals, "Pacific/Chatham")
+	c.Check(os.Getenv("TZ"), gc.Equals, "Pacific/Chatham")
+
+	restore()
+	c.Check(time.Local, gc.Equals, origLocal)
+	tz, tzSet := os.LookupEnv("TZ")
+	c.Check(tz, gc.Equals, origTZ)
+	c.Check(tzSet, gc.Equals, origTZSet)
+}
+
+func (*timeZoneSuite) TestPatchTimeZoneUnknown(c *gc.C) {
+	origLocal := time.Local
+	_, err := testing.PatchTimeZone("Nowhere/Special")
+	c.Assert(err, gc.ErrorMatches, `unknown time zone Nowhere/Special`)
+	c.Assert(time.Local, gc.Equals, origLocal)
+}
+
+func (*timeZoneSuite) TestSetUpTest(c *gc.C) {
+	origLocal := time.Local
+	s := testing.TimeZoneSuite{Zone: "America/St_Johns"}
+	s.SetUpTest(c)
+	c.Check(time.Local.String(), gc.Equals, "America/St_Johns")
+	c.Check(os.Getenv("TZ"), gc.Equals, "America/St_Johns")
+	c.Check(os.Getenv("LANG"), gc.Equals, "C")
+	c.Check(os.Getenv("LC_ALL"), gc.Equals, "C")
+	s.TearDownTest(c)
+	c.Check(time.Local, gc.Equals, origLocal)
+}
+
+func (*timeZoneSuite) TestSetUpTestDefaultsToUTC(c *gc.C) {
+	var s testing.TimeZoneSuite
+	s.SetUpTest(c)
+	defer s.TearDownTest(c)
+	c.Check(time.Local.String(), gc.Equals, "UTC")
+	t := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	c.Check(t.Local().Format(time.RFC3339), gc.Equals, "2020-01-01T00:00:00Z")
+}
+
+func (*timeZoneSuite) TestRunInZones(c *gc.C) {
+	s := testing.TimeZoneSuite{}
+	s.SetUpTest(c)
+	defer s.TearDownTest(c)
+
+	var zones []string
+	s.RunInZones(c, func(c *gc.C) {
+		zones = append(zones, time.Local.String())
+		c.Check(os.Getenv("TZ"), gc.Equals, time.Local.String())
+	})
+	c.Check(zones, jc.DeepEquals, testing.DefaultTestZones)
+	c.Check(time.Local.String(), gc.Equals, "UTC")
+	c.Check(c.GetTestLog(), gc.Matches, `(?s).*running in time zone "Pacific/Chatham".*`)
+}
+
+func (*timeZoneSuite) TestRunInZonesCustom(c *gc.C) {
+	s := testing.TimeZoneSuite{
+		Zones: []string{"Asia/Kathmandu", "UTC"},
+	}
+	var offsets []int
+	s.RunInZones(c, func(c *gc.C) {
+		t := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC).Local()
+		_, offset := t.Zone()
+		offsets = append(offsets, offset)
+	})
+	c.Check(offsets, jc.DeepEquals, []int{5*3600 + 45*60, 0})
+}
+
+func (*timeZoneSuite) TestRunInZonesLogsEachFailingZone(c *gc.C) {
+	var output bytes.Buffer
+	result := gc.Run(&zoneFailSuite{}, &gc.RunConf{Output: &output})
+	c.Assert(result.Failed, gc.Equals, 1)
+	c.Check(output.String(), gc.Matches, `(?s).*running in time zone "UTC"\n.*test failed in time zone "UTC"\n`+
+		`running in time zone "Pacific/Chatham"\n`+
+		`running in time zone "America/St_Johns"\n.*test failed in time zone "America/St_Johns"\n.*`)
+}
+
+// zoneFailSuite fails in every zone except Pacific/Chatham.
+type zoneFailSuite struct {
+	testing.TimeZoneSuite
+}
+
+func (s *zoneFailSuite) TestFail(c *gc.C) {
+	s.RunInZones(c, func(c *gc.C) {
+		c.Check(time.Local.String(), gc.Equals, "Pacific/Chatham")
+	})
+}
@@ -0,0 +1,336 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package testing
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"sync"
+	"syscall"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+// UDPProxy is a simple UDP proxy that can be used to
+// deliberately lose, duplicate and reorder datagrams.
+//
+// Each client address that sends datagrams to the proxy has
+// its own session, with its own socket to the remote address,
+// so that replies from the remote address are sent back to the
+// client that the remote address received datagrams from.
+type UDPProxy struct {
+	conn       *net.UDPConn
+	remoteAddr *net.UDPAddr
+	onError    func(error)
+	// mu guards the fields below it.
+	mu sync.Mutex
+	// stopStart holds a condition variable that broadcasts changes
+	// in the paused state.
+	stopStart sync.Cond
+	// closed holds whether the proxy has been closed.
+	closed bool
+	// paused holds whether the proxy has been paused.
+	paused bool
+	// sessions holds the active sessions, keyed by client address.
+	sessions map[string]*udpSession
+	// faults holds the faults injected in each direction.
+	faults [2]DatagramFaults
+}
+
+// DatagramFaults describes the faults that a UDPProxy injects into
+// the datagrams flowing through it in one direction. Each rate is
+// the probability, from 0 to 1, that the fault affects a datagram.
+type DatagramFaults struct {
+	// DropRate holds the probability that a datagram is dropped.
+	DropRate float64
+
+	// DuplicateRate holds the probability that a datagram
+	// is sent twice.
+	DuplicateRate float64
+
+	// ReorderRate holds the probability that a datagram is held
+	// back and sent after the datagram that follows it. A datagram
+	// that is held back is not sent until another one arrives.
+	ReorderRate float64
+}
+
+// udpSession holds the state of the datagrams
+// exchanged with one client of a UDPProxy.
+type udpSession struct {
+	// client holds the address of the client.
+	client *net.UDPAddr
+	// server holds the socket connected to the remote address.
+	server *net.UDPConn
+	// held holds the datagrams held back in each direction.
+	// It is guarded by the mutex of the proxy.
+	held [2][][]byte
+}
+
+// UDPProxyConfig holds the configuration of a UDPProxy.
+type UDPProxyConfig struct {
+	// RemoteAddr holds the UDP address that the
+	// proxy forwards datagrams to and from.
+	RemoteAddr string
+
+	// OnError, if not nil, is called with any error encountered
+	// by the proxy after it has started, such as a failure to dial
+	// the remote address. It is called from the goroutines that
+	// forward datagrams, so it should not block.
+	OnError func(error)
+}
+
+// NewUDPProxy runs a proxy that forwards datagrams to and from the
+// given remote UDP address, listening on a new address on 127.0.0.1.
+// When the proxy is closed, its socket and all sessions will be
+// closed. Any error encountered by the proxy is reported as a test
+// error. Tests that may finish while the proxy is still running
+// should use StartUDPProxy instead.
+func NewUDPProxy(c *gc.C, remoteAddr string) *UDPProxy {
+	p, err := StartUDPProxy(UDPProxyConfig{
+		RemoteAddr: remoteAddr,
+		OnError: func(err error) {
+			c.Errorf("%v", err)
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	return p
+}
+
+// StartUDPProxy starts a proxy with the given configuration,
+// listening on a new address on 127.0.0.1. When the proxy is
+// closed, its socket and all sessions will be closed.
+func StartUDPProxy(config UDPProxyConfig) (*UDPProxy, error) {
+	raddr, err := net.ResolveUDPAddr("udp", config.RemoteAddr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		return nil, err
+	}
+	p := &UDPProxy{
+		conn:       conn,
+		remoteAddr: raddr,
+		onError:    config.OnError,
+		sessions:   make(map[string]*udpSession),
+	}
+	p.stopStart.L = &p.mu
+	go p.run()
+	return p, nil
+}
+
+// run forwards datagrams from clients until the proxy is closed.
+func (p *UDPProxy) run() {
+	buf := make([]byte, 64*1024)
+	for {
+		n, client, err := p.conn.ReadFromUDP(buf)
+		if err != nil {
+			if !p.isClosed() {
+				p.reportError(fmt.Errorf("cannot read from UDP proxy: %w", err))
+			}
+			return
+		}
+		s, err := p.session(client)
+		if err != nil {
+			p.reportError(fmt.Errorf("cannot dial remote address: %w", err))
+			continue
+		}
+		if s == nil {
+			return
+		}
+		p.send(s, ClientToServer, append([]byte(nil), buf[:n]...))
+	}
+}
+
+// session returns the session for the given client, starting
+// a new one if needed. It returns nil if the proxy is closed.
+func (p *UDPProxy) session(client *net.UDPAddr) (*udpSession, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil, nil
+	}
+	if s := p.sessions[client.String()]; s != nil {
+		return s, nil
+	}
+	server, err := net.DialUDP("udp", nil, p.remoteAddr)
+	if err != nil {
+		return nil, err
+	}
+	s := &udpSession{
+		client: client,
+		server: server,
+	}
+	p.sessions[client.String()] = s
+	go p.reply(s)
+	return s, nil
+}
+
+// reportError calls the OnError callback, if any,
+// with the given error.
+func (p *UDPProxy) reportError(err error) {
+	if p.onError != nil {
+		p.onError(err)
+	}
+}
+
+// reply forwards datagrams from the remote address to the
+// client of the session until the session is closed, or
+// reading from the remote address fails, in which case the
+// session is closed and a new one is started when the client
+// next sends a datagram.
+func (p *UDPProxy) reply(s *udpSession) {
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := s.server.Read(buf)
+		if errors.Is(err, syscall.ECONNREFUSED) {
+			// An earlier datagram was refused by the
+			// remote address, so it was lost; keep going.
+			continue
+		}
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				p.reportError(fmt.Errorf("cannot read from remote address: %w", err))
+				p.closeSession(s)
+			}
+			return
+		}
+		p.send(s, ServerToClient, append([]byte(nil), buf[:n]...))
+	}
+}
+
+// send sends the datagram in the given direction
+// of the session, applying any injected faults.
+func (p *UDPProxy) send(s *udpSession, dir Direction, data []byte) {
+	p.mu.Lock()
+	for p.paused && !p.closed {
+		p.stopStart.Wait()
+	}
+	faults := p.faults[dir]
+	var out [][]byte
+	if !chance(faults.DropRate) {
+		datagrams := [][]byte{data}
+		if chance(faults.DuplicateRate) {
+			datagrams = append(datagrams, data)
+		}
+		switch {
+		case s.held[dir] != nil:
+			out = append(datagrams, s.held[dir]...)
+			s.held[dir] = nil
+		case chance(faults.ReorderRate):
+			s.held[dir] = datagrams
+		default:
+			out = datagrams
+		}
+	}
+	p.mu.Unlock()
+	for _, datagram := range out {
+		// Errors are ignored, as the datagram
+		// could have been lost anyway.
+		if dir == ClientToServer {
+			s.server.Write(datagram)
+		} else {
+			p.conn.WriteToUDP(datagram, s.client)
+		}
+	}
+}
+
+// chance reports whether an event with
+// the given probability happens.
+func chance(rate float64) bool {
+	return rate > 0 && rand.Float64() < rate
+}
+
+// SetFaults sets the faults injected into datagrams flowing
+// in the given direction, from the next datagram that is sent.
+func (p *UDPProxy) SetFaults(dir Direction, faults DatagramFaults) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.faults[dir] = faults
+}
+
+// Faults returns the faults injected into datagrams
+// flowing in the given direction.
+func (p *UDPProxy) Faults(dir Direction) DatagramFaults {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.faults[dir]
+}
+
+// Addr returns the UDP address of the proxy. Datagrams
+// sent to this address will be sent to the remote address,
+// and replies will be sent back to the sender.
+func (p *UDPProxy) Addr() string {
+	return p.conn.LocalAddr().String()
+}
+
+// Close closes the UDPProxy and any sessions
+// that are currently active.
+func (p *UDPProxy) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	p.conn.Close()
+	p.closeSessions()
+	p.stopStart.Broadcast()
+	return nil
+}
+
+// CloseConns closes all the sessions that are currently active,
+// discarding any datagrams that are held back. The proxy itself
+// remains active, and starts a new session, with a new socket to
+// the remote address, when a client next sends a datagram.
+func (p *UDPProxy) CloseConns() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closeSessions()
+}
+
+// closeSession closes the given session, if it is still active.
+func (p *UDPProxy) closeSession(s *udpSession) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	key := s.client.String()
+	if p.sessions[key] == s {
+		delete(p.sessions, key)
+	}
+	s.server.Close()
+}
+
+// closeSessions closes all the sessions.
+// It must be called with p.mu held.
+func (p *UDPProxy) closeSessions() {
+	for addr, s := range p.sessions {
+		s.server.Close()
+		delete(p.sessions, addr)
+	}
+}
+
+// PauseConns stops all datagrams flowing through the proxy.
+// Datagrams that arrive while the proxy is paused are sent
+// when it is resumed, unless they overflow the buffers of
+// the operating system.
+func (p *UDPProxy) PauseConns() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.paused = true
+	p.stopStart.Broadcast()
+}
+
+// ResumeConns resumes sending datagrams through the proxy.
+func (p *UDPProxy) ResumeConns() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.paused = false
+	p.stopStart.Broadcast()
+}
+
+func (p *UDPProxy) isClosed() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.closed
+}
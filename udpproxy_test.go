@@ -0,0 +1,170 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package testing_test
+
+import (
+	"net"
+	"time"
+
+	"github.com/juju/testing"
+	gc "gopkg.in/check.v1"
+)
+
+var _ = gc.Suite(&udpProxySuite{})
+
+type udpProxySuite struct{}
+
+func (*udpProxySuite) TestUDPProxy(c *gc.C) {
+	p, conn, echo := newUDPEchoProxy(c)
+	defer echo.Close()
+	defer p.Close()
+	defer conn.Close()
+
+	assertUDPEcho(c, conn, "hello")
+
+	// A new session is started after the sessions are closed.
+	p.CloseConns()
+	assertUDPEcho(c, conn, "hello")
+}
+
+func (*udpProxySuite) TestPauseConns(c *gc.C) {
+	p, conn, echo := newUDPEchoProxy(c)
+	defer echo.Close()
+	defer p.Close()
+	defer conn.Close()
+
+	p.PauseConns()
+	udpSend(c, conn, "hello")
+	assertReadTimeout(c, conn)
+	p.ResumeConns()
+	c.Assert(udpReceive(c, conn), gc.Equals, "hello")
+}
+
+func (*udpProxySuite) TestDrop(c *gc.C) {
+	p, conn, echo := newUDPEchoProxy(c)
+	defer echo.Close()
+	defer p.Close()
+	defer conn.Close()
+
+	p.SetFaults(testing.ServerToClient, testing.DatagramFaults{DropRate: 1})
+	c.Assert(p.Faults(testing.ServerToClient), gc.Equals, testing.DatagramFaults{DropRate: 1})
+	udpSend(c, conn, "hello")
+	assertReadTimeout(c, conn)
+
+	p.SetFaults(testing.ServerToClient, testing.DatagramFaults{})
+	assertUDPEcho(c, conn, "hello")
+}
+
+func (*udpProxySuite) TestDuplicate(c *gc.C) {
+	p, conn, echo := newUDPEchoProxy(c)
+	defer echo.Close()
+	defer p.Close()
+	defer conn.Close()
+
+	p.SetFaults(testing.ClientToServer, testing.DatagramFaults{DuplicateRate: 1})
+	udpSend(c, conn, "hello")
+	c.Assert(udpReceive(c, conn), gc.Equals, "hello")
+	c.Assert(udpReceive(c, conn), gc.Equals, "hello")
+	assertReadTimeout(c, conn)
+}
+
+func (*udpProxySuite) TestReorder(c *gc.C) {
+	p, conn, echo := newUDPEchoProxy(c)
+	defer echo.Close()
+	defer p.Close()
+	defer conn.Close()
+
+	p.SetFaults(testing.ClientToServer, testing.DatagramFaults{ReorderRate: 1})
+	udpSend(c, conn, "one")
+	assertReadTimeout(c, conn)
+	udpSend(c, conn, "two")
+	c.Assert(udpReceive(c, conn), gc.Equals, "two")
+	c.Assert(udpReceive(c, conn), gc.Equals, "one")
+}
+
+// newUDPEchoProxy starts a UDP echo server and a proxy to it, and
+// returns the proxy, a connection through it and the echo server.
+func (*udpProxySuite) TestRemoteRefused(c *gc.C) {
+	// Find an address that nothing is listening on.
+	echo, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	c.Assert(err, gc.IsNil)
+	remoteAddr := echo.LocalAddr().(*net.UDPAddr)
+	echo.Close()
+
+	errs := make(chan error, 10)
+	p, err := testing.StartUDPProxy(testing.UDPProxyConfig{
+		RemoteAddr: remoteAddr.String(),
+		OnError: func(err error) {
+			errs <- err
+		},
+	})
+	c.Assert(err, gc.IsNil)
+	defer p.Close()
+	addr, err := net.ResolveUDPAddr("udp", p.Addr())
+	c.Assert(err, gc.IsNil)
+	conn, err := net.DialUDP("udp", nil, addr)
+	c.Assert(err, gc.IsNil)
+	defer conn.Close()
+
+	// The datagram is refused by the remote address,
+	// which is not reported as an error, and the
+	// session keeps going once the remote address
+	// is listening.
+	udpSend(c, conn, "refused")
+	time.Sleep(testing.ShortWait)
+	echo, err = net.ListenUDP("udp", remoteAddr)
+	c.Assert(err, gc.IsNil)
+	defer echo.Close()
+	go udpEcho(echo)
+	assertUDPEcho(c, conn, "hello")
+	select {
+	case err := <-errs:
+		c.Fatalf("unexpected error: %v", err)
+	default:
+	}
+}
+
+func newUDPEchoProxy(c *gc.C) (*testing.UDPProxy, *net.UDPConn, *net.UDPConn) {
+	echo, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	c.Assert(err, gc.IsNil)
+	go udpEcho(echo)
+	p := testing.NewUDPProxy(c, echo.LocalAddr().String())
+	addr, err := net.ResolveUDPAddr("udp", p.Addr())
+	c.Assert(err, gc.IsNil)
+	conn, err := net.DialUDP("udp", nil, addr)
+	c.Assert(err, gc.IsNil)
+	return p, conn, echo
+}
+
+// udpEcho sends all datagrams received on
+// the given connection back to the sender.
+func udpEcho(conn *net.UDPConn) {
+	buf := make([]byte, 64*1024)
+	for {
+		n, addr, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		conn.WriteToUDP(buf[:n], addr)
+	}
+}
+
+func udpSend(c *gc.C, conn *net.UDPConn, msg string) {
+	_, err := conn.Write([]byte(msg))
+	c.Assert(err, gc.IsNil)
+}
+
+func udpReceive(c *gc.C, conn *net.UDPConn) string {
+	err := conn.SetReadDeadline(time.Now().Add(testing.LongWait))
+	c.Assert(err, gc.IsNil)
+	buf := make([]byte, 1024)
+	n, err := conn.Read(buf)
+	c.Assert(err, gc.IsNil)
+	return string(buf[:n])
+}
+
+func assertUDPEcho(c *gc.C, conn *net.UDPConn, msg string) {
+	udpSend(c, conn, msg)
+	c.Assert(udpReceive(c, conn), gc.Equals, msg)
+}